@@ -4,87 +4,162 @@
 // See page 333.
 
 // Package display provides a means to display structured data.
+//
+// Unlike the version in the book, it does not recurse forever on
+// cyclic data: a pointer, map or slice that refers back to a value
+// already being displayed is shown as a reference to its earlier
+// path, such as
+//
+//	(*c.Tail).Tail = c.Tail (cycle)
+//
+// Fprint can also limit the depth and the number of elements shown,
+// which makes it safe to use on large, live data structures.
+// Map entries are shown in order of their keys, so the output
+// for a given value is always the same.
 package display
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"reflect"
-	"strconv"
+
+	"gopl.io/ch12/format"
 )
 
 //!+Display
 
 func Display(name string, x interface{}) {
-	fmt.Printf("Display %s (%T):\n", name, x)
-	display(name, reflect.ValueOf(x))
+	Fprint(os.Stdout, name, x, Options{})
 }
 
 //!-Display
 
-// formatAtom formats a value without inspecting its internal structure.
-// It is a copy of the the function in gopl.io/ch11/format.
-func formatAtom(v reflect.Value) string {
-	switch v.Kind() {
-	case reflect.Invalid:
-		return "invalid"
-	case reflect.Int, reflect.Int8, reflect.Int16,
-		reflect.Int32, reflect.Int64:
-		return strconv.FormatInt(v.Int(), 10)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16,
-		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return strconv.FormatUint(v.Uint(), 10)
-	// ...floating-point and complex cases omitted for brevity...
-	case reflect.Bool:
-		if v.Bool() {
-			return "true"
-		}
-		return "false"
-	case reflect.String:
-		return strconv.Quote(v.String())
-	case reflect.Chan, reflect.Func, reflect.Ptr,
-		reflect.Slice, reflect.Map:
-		return v.Type().String() + " 0x" +
-			strconv.FormatUint(uint64(v.Pointer()), 16)
-	default: // reflect.Array, reflect.Struct, reflect.Interface
-		return v.Type().String() + " value"
+// Options controls the output of Fprint.
+type Options struct {
+	// MaxDepth is the maximum number of selectors, indexes and
+	// indirections followed from the root value; a value at that
+	// depth is displayed as an atom. Zero means no limit.
+	MaxDepth int
+
+	// MaxElements is the maximum number of elements displayed
+	// for each array, slice or map. Zero means no limit.
+	MaxElements int
+}
+
+// Fprint writes the display of x, under the given name, to w,
+// and returns the first write error, if any.
+func Fprint(w io.Writer, name string, x interface{}, opts Options) error {
+	p := &printer{w: w, opts: opts, active: make(map[ref]string)}
+	p.printf("Display %s (%T):\n", name, x)
+	p.display(name, reflect.ValueOf(x), 0)
+	return p.err
+}
+
+// A printer holds the state of a single call to Fprint.
+type printer struct {
+	w      io.Writer
+	opts   Options
+	active map[ref]string // pointers, maps and slices being displayed, and their paths
+	err    error
+}
+
+// A ref identifies the referent of a pointer, map or slice.
+type ref struct {
+	ptr uintptr
+	typ reflect.Type // distinguishes a struct from its first field
+	len int          // distinguishes a slice from its prefixes
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
 	}
 }
 
 //!+display
-func display(path string, v reflect.Value) {
+func (p *printer) display(path string, v reflect.Value, depth int) {
+	if p.err != nil {
+		return
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
-		fmt.Printf("%s = invalid\n", path)
+		p.printf("%s = invalid\n", path)
+		return
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			p.printf("%s = nil\n", path)
+			return
+		}
+	case reflect.Map, reflect.Slice:
+		if v.Len() == 0 {
+			return // nothing to display
+		}
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Struct, reflect.Map,
+		reflect.Ptr, reflect.Interface:
+		if p.opts.MaxDepth > 0 && depth >= p.opts.MaxDepth {
+			p.printf("%s = %s (max depth)\n", path, format.Atom(v))
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		r := ref{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			r.len = v.Len()
+		}
+		if earlier, ok := p.active[r]; ok {
+			p.printf("%s = %s (cycle)\n", path, earlier)
+			return
+		}
+		p.active[r] = path
+		defer delete(p.active, r)
+	}
+
+	switch v.Kind() {
 	case reflect.Slice, reflect.Array:
-		for i := 0; i < v.Len(); i++ {
-			display(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		n := p.limit(v.Len())
+		for i := 0; i < n; i++ {
+			p.display(fmt.Sprintf("%s[%d]", path, i), v.Index(i), depth+1)
 		}
+		p.more(path, v.Len()-n)
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
 			fieldPath := fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name)
-			display(fieldPath, v.Field(i))
+			p.display(fieldPath, v.Field(i), depth+1)
 		}
 	case reflect.Map:
-		for _, key := range v.MapKeys() {
-			display(fmt.Sprintf("%s[%s]", path,
-				formatAtom(key)), v.MapIndex(key))
+		n := p.limit(v.Len())
+		for _, e := range format.SortedMap(v)[:n] {
+			p.display(fmt.Sprintf("%s[%s]", path,
+				format.Key(e.Key)), e.Value, depth+1)
 		}
+		p.more(path, v.Len()-n)
 	case reflect.Ptr:
-		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
-		} else {
-			display(fmt.Sprintf("(*%s)", path), v.Elem())
-		}
+		p.display(fmt.Sprintf("(*%s)", path), v.Elem(), depth+1)
 	case reflect.Interface:
-		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
-		} else {
-			fmt.Printf("%s.type = %s\n", path, v.Elem().Type())
-			display(path+".value", v.Elem())
-		}
+		p.printf("%s.type = %s\n", path, v.Elem().Type())
+		p.display(path+".value", v.Elem(), depth+1)
 	default: // basic types, channels, funcs
-		fmt.Printf("%s = %s\n", path, formatAtom(v))
+		p.printf("%s = %s\n", path, format.Atom(v))
 	}
 }
 
 //!-display
+
+// limit returns how many of n elements to display.
+func (p *printer) limit(n int) int {
+	if max := p.opts.MaxElements; max > 0 && n > max {
+		return max
+	}
+	return n
+}
+
+// more notes that n elements of the value at path were omitted.
+func (p *printer) more(path string, n int) {
+	if n > 0 {
+		p.printf("%s[...] = (%d more)\n", path, n)
+	}
+}
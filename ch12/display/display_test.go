@@ -4,12 +4,18 @@
 package display
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"gopl.io/ch7/eval"
 )
@@ -31,6 +37,10 @@ func Example_expr() {
 	// e.args[0].value.x.value = "A"
 	// e.args[0].value.y.type = eval.Var
 	// e.args[0].value.y.value = "pi"
+	// e.pos.Filename = ""
+	// e.pos.Offset = 0
+	// e.pos.Line = 1
+	// e.pos.Column = 1
 }
 
 func Example_slice() {
@@ -90,6 +100,20 @@ func Example_array() {
 	// x[0].value = 3
 }
 
+func Example_structKeys() {
+	type P struct{ X, Y int }
+	Display("m", map[P]int{{2, 1}: 3, {1, 2}: 2, {1, 1}: 1})
+	Display("s", map[[2]int]bool{{1, 0}: true, {0, 5}: false})
+	// Output:
+	// Display m (map[display.P]int):
+	// m[display.P{X: 1, Y: 1}] = 1
+	// m[display.P{X: 1, Y: 2}] = 2
+	// m[display.P{X: 2, Y: 1}] = 3
+	// Display s (map[[2]int]bool):
+	// s[[2]int{0, 5}] = false
+	// s[[2]int{1, 0}] = true
+}
+
 func Example_movie() {
 	//!+movie
 	type Movie struct {
@@ -126,28 +150,54 @@ func Example_movie() {
 	//!-strangelove
 	Display("strangelove", strangelove)
 
-	// We don't use an Output: comment since displaying
-	// a map is nondeterministic.
-	/*
-		//!+output
-		Display strangelove (display.Movie):
-		strangelove.Title = "Dr. Strangelove"
-		strangelove.Subtitle = "How I Learned to Stop Worrying and Love the Bomb"
-		strangelove.Year = 1964
-		strangelove.Color = false
-		strangelove.Actor["Gen. Buck Turgidson"] = "George C. Scott"
-		strangelove.Actor["Brig. Gen. Jack D. Ripper"] = "Sterling Hayden"
-		strangelove.Actor["Maj. T.J. \"King\" Kong"] = "Slim Pickens"
-		strangelove.Actor["Dr. Strangelove"] = "Peter Sellers"
-		strangelove.Actor["Grp. Capt. Lionel Mandrake"] = "Peter Sellers"
-		strangelove.Actor["Pres. Merkin Muffley"] = "Peter Sellers"
-		strangelove.Oscars[0] = "Best Actor (Nomin.)"
-		strangelove.Oscars[1] = "Best Adapted Screenplay (Nomin.)"
-		strangelove.Oscars[2] = "Best Director (Nomin.)"
-		strangelove.Oscars[3] = "Best Picture (Nomin.)"
-		strangelove.Sequel = nil
-		//!-output
-	*/
+	// Map keys are displayed in sorted order.
+
+	// Output:
+	// Display strangelove (display.Movie):
+	// strangelove.Title = "Dr. Strangelove"
+	// strangelove.Subtitle = "How I Learned to Stop Worrying and Love the Bomb"
+	// strangelove.Year = 1964
+	// strangelove.Color = false
+	// strangelove.Actor["Brig. Gen. Jack D. Ripper"] = "Sterling Hayden"
+	// strangelove.Actor["Dr. Strangelove"] = "Peter Sellers"
+	// strangelove.Actor["Gen. Buck Turgidson"] = "George C. Scott"
+	// strangelove.Actor["Grp. Capt. Lionel Mandrake"] = "Peter Sellers"
+	// strangelove.Actor["Maj. T.J. \"King\" Kong"] = "Slim Pickens"
+	// strangelove.Actor["Pres. Merkin Muffley"] = "Peter Sellers"
+	// strangelove.Oscars[0] = "Best Actor (Nomin.)"
+	// strangelove.Oscars[1] = "Best Adapted Screenplay (Nomin.)"
+	// strangelove.Oscars[2] = "Best Director (Nomin.)"
+	// strangelove.Oscars[3] = "Best Picture (Nomin.)"
+	// strangelove.Sequel = nil
+}
+
+func Example_atoms() {
+	type Reading struct {
+		Celsius float32
+		Phase   complex128
+		Elapsed time.Duration
+		Err     error
+	}
+	Display("r", map[float64]Reading{
+		math.NaN(): {Err: errors.New("no signal")},
+		10:         {Celsius: 21.5, Phase: 1 - 0.5i, Elapsed: 90 * time.Second},
+		2.5:        {Celsius: -4},
+	})
+	// Output:
+	// Display r (map[float64]display.Reading):
+	// r[NaN].Celsius = 0
+	// r[NaN].Phase = (0+0i)
+	// r[NaN].Elapsed = 0s
+	// r[NaN].Err.type = *errors.errorString
+	// (*r[NaN].Err.value).s = "no signal"
+	// r[2.5].Celsius = -4
+	// r[2.5].Phase = (0+0i)
+	// r[2.5].Elapsed = 0s
+	// r[2.5].Err = nil
+	// r[10].Celsius = 21.5
+	// r[10].Phase = (1-0.5i)
+	// r[10].Elapsed = 1m30s
+	// r[10].Err = nil
 }
 
 // This test ensures that the program terminates without crashing.
@@ -206,39 +256,23 @@ func Test(t *testing.T) {
 	// (*rV.typ).hash = 871609668
 	// (*rV.typ)._ = 0
 	// ...
+}
 
+func TestCycles(t *testing.T) {
 	// a pointer that points to itself
 	type P *P
 	var p P
 	p = &p
-	if false {
-		Display("p", p)
-		// Output:
-		// Display p (display.P):
-		// ...stuck, no output...
-	}
 
 	// a map that contains itself
 	type M map[string]M
 	m := make(M)
 	m[""] = m
-	if false {
-		Display("m", m)
-		// Output:
-		// Display m (display.M):
-		// ...stuck, no output...
-	}
 
 	// a slice that contains itself
 	type S []S
 	s := make(S, 1)
 	s[0] = s
-	if false {
-		Display("s", s)
-		// Output:
-		// Display s (display.S):
-		// ...stuck, no output...
-	}
 
 	// a linked list that eats its own tail
 	type Cycle struct {
@@ -247,13 +281,90 @@ func Test(t *testing.T) {
 	}
 	var c Cycle
 	c = Cycle{42, &c}
-	if false {
-		Display("c", c)
-		// Output:
-		// Display c (display.Cycle):
-		// c.Value = 42
-		// (*c.Tail).Value = 42
-		// (*(*c.Tail).Tail).Value = 42
-		// ...ad infinitum...
+
+	for _, test := range []struct {
+		name string
+		x    interface{}
+		want string
+	}{
+		{"p", p, `Display p (display.P):
+(*p) = p (cycle)
+`},
+		{"m", m, `Display m (display.M):
+m[""] = m (cycle)
+`},
+		{"s", s, `Display s (display.S):
+s[0] = s (cycle)
+`},
+		{"c", c, `Display c (display.Cycle):
+c.Value = 42
+(*c.Tail).Value = 42
+(*c.Tail).Tail = c.Tail (cycle)
+`},
+	} {
+		var buf bytes.Buffer
+		if err := Fprint(&buf, test.name, test.x, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("Fprint(%s) =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+
+	// A pointer reached twice, but not through itself, is not a cycle.
+	x := new(int)
+	var buf bytes.Buffer
+	Fprint(&buf, "x", [2]*int{x, x}, Options{})
+	const want = `Display x ([2]*int):
+(*x[0]) = 0
+(*x[1]) = 0
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Fprint(x) =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	type Tree struct {
+		Name  string
+		Left  *Tree
+		Items []int
+	}
+	tree := &Tree{"a", &Tree{"b", &Tree{Name: "c"}, nil}, []int{1, 2, 3, 4}}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, "t", tree, Options{MaxDepth: 4, MaxElements: 2}); err != nil {
+		t.Fatal(err)
+	}
+	const want = `Display t (*display.Tree):
+(*t).Name = "a"
+(*(*t).Left).Name = "b"
+(*(*t).Left).Left = *display.Tree 0xADDR (max depth)
+(*t).Items[0] = 1
+(*t).Items[1] = 2
+(*t).Items[...] = (2 more)
+`
+	got := buf.String()
+	got = strings.Replace(got, fmt.Sprintf("%p", tree.Left.Left), "0xADDR", 1)
+	if got != want {
+		t.Errorf("Fprint =\n%s\nwant\n%s", got, want)
+	}
+
+	// Printing stops at the first write error.
+	w := &failWriter{n: 2}
+	if err := Fprint(w, "t", tree, Options{}); err != errFail || w.n != 0 {
+		t.Errorf("Fprint to failing writer = %v after %d writes", err, 2-w.n)
+	}
+}
+
+var errFail = errors.New("write failed")
+
+// A failWriter fails after n successful writes.
+type failWriter struct{ n int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errFail
 	}
+	w.n--
+	return len(p), nil
 }
@@ -8,17 +8,25 @@
 package format
 
 import (
+	"fmt"
 	"reflect"
 	"strconv"
 )
 
 // Any formats any value as a string.
 func Any(value interface{}) string {
-	return formatAtom(reflect.ValueOf(value))
+	return Atom(reflect.ValueOf(value))
 }
 
-// formatAtom formats a value without inspecting its internal structure.
-func formatAtom(v reflect.Value) string {
+// Atom formats a value without inspecting its internal structure.
+// A value whose type has an Error or String method is formatted
+// by calling it, as by fmt.Print. Other values are formatted
+// according to their kind, with reference types shown as an
+// address and other composite types only by their type.
+func Atom(v reflect.Value) string {
+	if s, ok := methodString(v); ok {
+		return s
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		return "invalid"
@@ -28,17 +36,45 @@ func formatAtom(v reflect.Value) string {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16,
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return strconv.FormatUint(v.Uint(), 10)
-	// ...floating-point and complex cases omitted for brevity...
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
 	case reflect.Bool:
 		return strconv.FormatBool(v.Bool())
 	case reflect.String:
 		return strconv.Quote(v.String())
-	case reflect.Chan, reflect.Func, reflect.Ptr, reflect.Slice, reflect.Map:
+	case reflect.Chan, reflect.Func, reflect.Ptr, reflect.Slice, reflect.Map,
+		reflect.UnsafePointer:
 		return v.Type().String() + " 0x" +
 			strconv.FormatUint(uint64(v.Pointer()), 16)
-	default: // reflect.Array, reflect.Struct, reflect.Interface
+	case reflect.Interface:
+		if v.IsNil() {
+			return "nil"
+		}
+		return Atom(v.Elem())
+	default: // reflect.Array, reflect.Struct
 		return v.Type().String() + " value"
 	}
 }
 
 //!-
+
+// methodString returns the result of v's Error or String method,
+// if it has one that can be called. A nil pointer's method is
+// not called, since it would most likely panic.
+func methodString(v reflect.Value) (string, bool) {
+	if !v.IsValid() || !v.CanInterface() || v.Kind() == reflect.Interface {
+		return "", false
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return "", false
+	}
+	switch x := v.Interface().(type) {
+	case error:
+		return x.Error(), true
+	case fmt.Stringer:
+		return x.String(), true
+	}
+	return "", false
+}
@@ -5,8 +5,12 @@ package format_test
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
 
 	"gopl.io/ch12/format"
 )
@@ -17,8 +21,101 @@ func Test(t *testing.T) {
 	var x int64 = 1
 	var d time.Duration = 1 * time.Nanosecond
 	fmt.Println(format.Any(x))                  // "1"
-	fmt.Println(format.Any(d))                  // "1"
+	fmt.Println(format.Any(d))                  // "1ns"
 	fmt.Println(format.Any([]int64{x}))         // "[]int64 0x8202b87b0"
 	fmt.Println(format.Any([]time.Duration{d})) // "[]time.Duration 0x8202b87e0"
 	//!-time
 }
+
+type celsius float64
+
+func (c celsius) String() string { return fmt.Sprintf("%g°C", float64(c)) }
+
+func TestAtom(t *testing.T) {
+	var nilStringer *time.Location
+	for _, test := range []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, "invalid"},
+		{int8(-3), "-3"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{1.5, "1.5"},
+		{float32(0.1), "0.1"},
+		{complex(1, -2), "(1-2i)"},
+		{complex64(0.1i), "(0+0.1i)"},
+		{true, "true"},
+		{"a\tb", `"a\tb"`},
+		{[2]int{}, "[2]int value"},
+		{struct{}{}, "struct {} value"},
+		{[]int(nil), "[]int 0x0"},
+		{nilStringer, "*time.Location 0x0"},
+		{2 * time.Second, "2s"},
+		{celsius(21.5), "21.5°C"},
+		{fmt.Errorf("oops"), "oops"},
+	} {
+		if got := format.Any(test.value); got != test.want {
+			t.Errorf("Any(%#v) = %s, want %s", test.value, got, test.want)
+		}
+	}
+
+	// Interface values are formatted by their dynamic value,
+	// and unsafe pointers by address.
+	var x struct {
+		I, J interface{}
+		P    unsafe.Pointer
+	}
+	x.I = 42
+	if got := format.Atom(reflect.ValueOf(x).Field(0)); got != "42" {
+		t.Errorf("Atom(I) = %s, want 42", got)
+	}
+	if got := format.Atom(reflect.ValueOf(x).Field(1)); got != "nil" {
+		t.Errorf("Atom(J) = %s, want nil", got)
+	}
+	if got := format.Atom(reflect.ValueOf(x).Field(2)); got != "unsafe.Pointer 0x0" {
+		t.Errorf("Atom(P) = %s, want unsafe.Pointer 0x0", got)
+	}
+}
+
+type point struct {
+	X, Y int
+	Name string
+}
+
+func TestSortedMap(t *testing.T) {
+	// Struct, array and interface keys are ordered element by element,
+	// whatever the map's iteration order.
+	for i := 0; i < 20; i++ {
+		m := map[point]int{{2, 1, "a"}: 4, {1, 2, "b"}: 2, {1, 2, "a"}: 1, {1, 3, ""}: 3}
+		var got []string
+		for _, e := range format.SortedMap(reflect.ValueOf(m)) {
+			got = append(got, format.Key(e.Key)+"="+format.Atom(e.Value))
+		}
+		const want = `format_test.point{X: 1, Y: 2, Name: "a"}=1 ` +
+			`format_test.point{X: 1, Y: 2, Name: "b"}=2 ` +
+			`format_test.point{X: 1, Y: 3, Name: ""}=3 ` +
+			`format_test.point{X: 2, Y: 1, Name: "a"}=4`
+		if s := strings.Join(got, " "); s != want {
+			t.Fatalf("SortedMap(map[point]int) = %s, want %s", s, want)
+		}
+
+		a := map[[2]int]bool{{1, 2}: true, {0, 5}: false, {1, 0}: true}
+		got = nil
+		for _, e := range format.SortedMap(reflect.ValueOf(a)) {
+			got = append(got, format.Key(e.Key))
+		}
+		if s, want := strings.Join(got, " "), "[2]int{0, 5} [2]int{1, 0} [2]int{1, 2}"; s != want {
+			t.Fatalf("SortedMap(map[[2]int]bool) = %s, want %s", s, want)
+		}
+
+		nan := math.NaN()
+		keys := map[interface{}]int{nan: 0, 1.5: 0, -1.0: 0, "b": 0, "a": 0, nil: 0, [1]int{7}: 0}
+		got = nil
+		for _, e := range format.SortedMap(reflect.ValueOf(keys)) {
+			got = append(got, format.Key(e.Key))
+		}
+		if s, want := strings.Join(got, " "), `nil [1]int{7} NaN -1 1.5 "a" "b"`; s != want {
+			t.Fatalf("SortedMap(map[interface{}]int) = %s, want %s", s, want)
+		}
+	}
+}
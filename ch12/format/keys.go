@@ -0,0 +1,129 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package format
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A MapEntry is a key and its value in a map.
+type MapEntry struct{ Key, Value reflect.Value }
+
+// SortedMap returns the entries of the map v sorted by key, as
+// by Compare, so that printing or encoding the same map always
+// produces the same output. Unlike MapIndex, it finds the values
+// of NaN keys.
+func SortedMap(v reflect.Value) []MapEntry {
+	var entries []MapEntry
+	for iter := v.MapRange(); iter.Next(); {
+		entries = append(entries, MapEntry{iter.Key(), iter.Value()})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	return entries
+}
+
+// Compare returns -1, 0, or +1 according to whether the map key x
+// is less than, equal to, or greater than y, which has the same type.
+//
+// Numbers are ordered numerically, with NaN first, strings
+// lexically, and false before true. Arrays and structs are
+// ordered element by element. Interface values are ordered first
+// by the name of the dynamic type, with nil first. Pointers and
+// channels are ordered by address, which is stable only within
+// one run of the program.
+func Compare(x, y reflect.Value) int {
+	switch x.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(x.Int() < y.Int(), x.Int() > y.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return compareOrdered(x.Uint() < y.Uint(), x.Uint() > y.Uint())
+	case reflect.String:
+		return compareOrdered(x.String() < y.String(), x.String() > y.String())
+	case reflect.Float32, reflect.Float64:
+		return compareFloat(x.Float(), y.Float())
+	case reflect.Complex64, reflect.Complex128:
+		if c := compareFloat(real(x.Complex()), real(y.Complex())); c != 0 {
+			return c
+		}
+		return compareFloat(imag(x.Complex()), imag(y.Complex()))
+	case reflect.Bool:
+		return compareOrdered(!x.Bool() && y.Bool(), x.Bool() && !y.Bool())
+	case reflect.Ptr, reflect.UnsafePointer, reflect.Chan:
+		return compareOrdered(x.Pointer() < y.Pointer(), x.Pointer() > y.Pointer())
+	case reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			if c := Compare(x.Index(i), y.Index(i)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if c := Compare(x.Field(i), y.Field(i)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return compareOrdered(x.IsNil() && !y.IsNil(), !x.IsNil() && y.IsNil())
+		}
+		xt, yt := x.Elem().Type(), y.Elem().Type()
+		if xt != yt { // distinct types with the same name compare equal
+			return compareOrdered(xt.String() < yt.String(), xt.String() > yt.String())
+		}
+		return Compare(x.Elem(), y.Elem())
+	}
+	return 0 // not a valid map key type; keep the original order
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return +1
+	}
+	return 0
+}
+
+func compareFloat(x, y float64) int {
+	if x != x || y != y { // NaN
+		return compareOrdered(x != x && y == y, x == x && y != y)
+	}
+	return compareOrdered(x < y, x > y)
+}
+
+// Key formats a map key as Atom does, except that an array or
+// struct without an Error or String method is formatted by its
+// elements, such as [2]int{1, 2} or main.P{X: 1, Y: "a"}, so that
+// distinct keys are formatted distinctly.
+func Key(v reflect.Value) string {
+	if s, ok := methodString(v); ok {
+		return s
+	}
+	var elems []string
+	switch v.Kind() {
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, Key(v.Index(i)))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			elems = append(elems, v.Type().Field(i).Name+": "+Key(v.Field(i)))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			return Key(v.Elem())
+		}
+		fallthrough
+	default:
+		return Atom(v)
+	}
+	return v.Type().String() + "{" + strings.Join(elems, ", ") + "}"
+}
@@ -0,0 +1,351 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package inspect describes Go types using reflection.
+//
+// It generalizes gopl.io/ch12/methods: rather than printing the
+// method set of one value, it returns a Report that describes the
+// method sets of a type T and of *T, the fields of a struct type,
+// including those promoted from embedded fields, and which of a list
+// of candidate interfaces T and *T implement, with the reasons for
+// any that they do not. A Report can be written as text or as JSON.
+package inspect
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// A Report describes a type T and its pointer type *T.
+type Report struct {
+	Type       string      `json:"type"`
+	Kind       string      `json:"kind"`
+	Methods    []Method    `json:"methods"`
+	Fields     []Field     `json:"fields,omitempty"`
+	Interfaces []Interface `json:"interfaces,omitempty"`
+}
+
+// A Method is an exported method in the method set of *T.
+type Method struct {
+	Name      string   `json:"name"`
+	Signature string   `json:"signature"`     // such as "(io.Writer, string) (int, error)"
+	Pointer   bool     `json:"pointer"`       // only in the method set of *T
+	Via       []string `json:"via,omitempty"` // embedded fields it is promoted through
+}
+
+// A Field is a field of the struct type T, or one promoted
+// into it from an embedded field.
+type Field struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Tag      string   `json:"tag,omitempty"`
+	Offset   uintptr  `json:"offset"` // within the struct that declares the field
+	Index    []int    `json:"index"`  // as for reflect.Value.FieldByIndex
+	Exported bool     `json:"exported"`
+	Embedded bool     `json:"embedded"`
+	Via      []string `json:"via,omitempty"` // embedded fields it is promoted through
+}
+
+// An Interface reports whether T and *T implement an interface,
+// and if not, why not.
+type Interface struct {
+	Name    string `json:"name"`
+	Value   bool   `json:"value"`   // T implements the interface
+	Pointer bool   `json:"pointer"` // *T implements the interface
+
+	// Missing lists the methods of the interface that *T lacks,
+	// such as "Close() error"; WrongType, those that *T has with
+	// another signature; and PointerOnly, those that only *T has.
+	Missing     []string `json:"missing,omitempty"`
+	WrongType   []string `json:"wrongType,omitempty"`
+	PointerOnly []string `json:"pointerOnly,omitempty"`
+}
+
+// Of returns a Report on the type of x, as described at Type.
+func Of(x interface{}, interfaces ...reflect.Type) *Report {
+	return Type(reflect.TypeOf(x), interfaces...)
+}
+
+// Type returns a Report on type t, checking whether it implements
+// each of the given interface types. If t is a pointer type *T,
+// other than a pointer to a pointer or interface, the Report is
+// on T. Type panics if any of interfaces is not an interface type.
+//
+// Whether a method is promoted is decided by reflection where
+// possible; otherwise, as when T declares a method with the name and
+// signature of a method of an embedded field, it relies on how the
+// gc toolchain marks the wrappers it generates for promoted methods.
+func Type(t reflect.Type, interfaces ...reflect.Type) *Report {
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() != reflect.Ptr &&
+		t.Elem().Kind() != reflect.Interface {
+		t = t.Elem()
+	}
+	r := &Report{Type: t.String(), Kind: t.Kind().String(), Methods: methods(t)}
+	if t.Kind() == reflect.Struct {
+		r.Fields = fields(t)
+	}
+	for _, iface := range interfaces {
+		if iface.Kind() != reflect.Interface {
+			panic("inspect: " + iface.String() + " is not an interface type")
+		}
+		r.Interfaces = append(r.Interfaces, implements(t, iface))
+	}
+	return r
+}
+
+// methodSet returns the type whose method set includes all
+// methods of t and *t: *t, unless t is an interface type.
+func methodSet(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Interface {
+		return t
+	}
+	return reflect.PtrTo(t)
+}
+
+// methods returns the methods of t and *t.
+func methods(t reflect.Type) []Method {
+	ms := methodSet(t)
+	result := []Method{}
+	for i := 0; i < ms.NumMethod(); i++ {
+		m := ms.Method(i)
+		_, inValue := t.MethodByName(m.Name)
+		result = append(result, Method{
+			Name:      m.Name,
+			Signature: signature(m.Type, ms),
+			Pointer:   !inValue,
+			Via:       promotedMethod(t, m.Name, inValue),
+		})
+	}
+	return result
+}
+
+// signature returns the signature of the method type ft, such as
+// "(string) string". Unless ms is an interface, the type of a method
+// obtained from ms has an initial receiver parameter, which is omitted.
+func signature(ft reflect.Type, ms reflect.Type) string {
+	first := 0
+	if ms.Kind() != reflect.Interface {
+		first = 1
+	}
+	var params []string
+	for i := first; i < ft.NumIn(); i++ {
+		if ft.IsVariadic() && i == ft.NumIn()-1 {
+			params = append(params, "..."+ft.In(i).Elem().String())
+		} else {
+			params = append(params, ft.In(i).String())
+		}
+	}
+	sig := "(" + strings.Join(params, ", ") + ")"
+	switch ft.NumOut() {
+	case 0:
+	case 1:
+		sig += " " + ft.Out(0).String()
+	default:
+		var results []string
+		for i := 0; i < ft.NumOut(); i++ {
+			results = append(results, ft.Out(i).String())
+		}
+		sig += " (" + strings.Join(results, ", ") + ")"
+	}
+	return sig
+}
+
+// An embedded field found while searching a struct type.
+type embedded struct {
+	typ reflect.Type // the field type, without any pointer
+	via []string     // names of the embedded fields leading to it
+}
+
+// embeddedFields returns the embedded fields of struct type t, by
+// increasing depth, following embedded pointers. Each type is
+// visited once.
+func embeddedFields(t reflect.Type) [][]embedded {
+	var levels [][]embedded
+	visited := map[reflect.Type]bool{t: true}
+	current := []embedded{{typ: t}}
+	for len(current) > 0 {
+		var next []embedded
+		for _, e := range current {
+			if e.typ.Kind() != reflect.Struct {
+				continue
+			}
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				if !sf.Anonymous {
+					continue
+				}
+				typ := sf.Type
+				if typ.Kind() == reflect.Ptr {
+					typ = typ.Elem()
+				}
+				if visited[typ] {
+					continue
+				}
+				visited[typ] = true
+				via := append(append([]string(nil), e.via...), sf.Name)
+				next = append(next, embedded{typ, via})
+			}
+		}
+		if len(next) > 0 {
+			levels = append(levels, next)
+		}
+		current = next
+	}
+	return levels
+}
+
+// promotedMethod returns the embedded fields through which the method
+// of t with the given name is promoted, or nil if it is not promoted.
+// inValue reports whether the method is in the method set of t.
+//
+// By the selector rules, the method is promoted only if there is
+// exactly one method of that name at the shallowest depth at which
+// any embedded field has one, with the same signature, and no field
+// of that name at that depth or shallower; and then only if t does
+// not declare the method itself. Reflection can decide the first
+// conditions, but not the last; see declared.
+func promotedMethod(t reflect.Type, name string, inValue bool) []string {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	ms := methodSet(t)
+	m, _ := ms.MethodByName(name)
+	for depth, level := range embeddedFields(t) {
+		var via []string
+		n := 0
+		for _, e := range level {
+			if em, ok := methodSet(e.typ).MethodByName(name); ok {
+				n++
+				if signature(em.Type, methodSet(e.typ)) == signature(m.Type, ms) {
+					via = e.via
+				}
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		// Fields of t are at depth 0, and methods of
+		// the embedded fields in level at depth+1.
+		if f, ok := t.FieldByName(name); ok && len(f.Index)-1 <= depth+1 {
+			return nil // hidden by a field
+		}
+		if n > 1 || via == nil || declared(t, name, inValue) {
+			return nil // ambiguous, or the embedded one differs, or t's own
+		}
+		return via
+	}
+	return nil
+}
+
+// declared reports whether the named method of t is declared by t
+// (or *t), as opposed to promoted from an embedded field with the
+// same signature. Reflection does not record this, so declared relies
+// on a detail of the gc toolchain: the compiler generates a wrapper
+// for each promoted method, and the runtime reports its file as
+// "<autogenerated>". TestAutogeneratedWrappers checks this assumption.
+func declared(t reflect.Type, name string, inValue bool) bool {
+	recv := t
+	if !inValue {
+		recv = reflect.PtrTo(t)
+	}
+	m, ok := recv.MethodByName(name)
+	if !ok {
+		return false
+	}
+	return !isWrapper(m.Func.Pointer())
+}
+
+// isWrapper reports whether the function at pc was generated by
+// the compiler, rather than declared in the source.
+func isWrapper(pc uintptr) bool {
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return false
+	}
+	file, _ := f.FileLine(f.Entry())
+	return file == "<autogenerated>"
+}
+
+// fields returns the fields of struct type t, followed by
+// the fields promoted into it, by increasing depth.
+func fields(t reflect.Type) []Field {
+	var result []Field
+	add := func(st reflect.Type, index []int, via []string) {
+		for i := 0; i < st.NumField(); i++ {
+			sf := st.Field(i)
+			sf.Index = append(append([]int(nil), index...), i)
+			if len(via) > 0 {
+				// Include the field only if it is not hidden
+				// by a shallower or ambiguous one.
+				found, ok := t.FieldByName(sf.Name)
+				if !ok || !equalIndex(found.Index, sf.Index) {
+					continue
+				}
+			}
+			result = append(result, Field{
+				Name:     sf.Name,
+				Type:     sf.Type.String(),
+				Tag:      string(sf.Tag),
+				Offset:   sf.Offset,
+				Index:    sf.Index,
+				Exported: sf.PkgPath == "",
+				Embedded: sf.Anonymous,
+				Via:      via,
+			})
+		}
+	}
+	add(t, nil, nil)
+	for _, level := range embeddedFields(t) {
+		for _, e := range level {
+			if e.typ.Kind() != reflect.Struct {
+				continue
+			}
+			sf, ok := t.FieldByName(e.via[len(e.via)-1])
+			if !ok || len(sf.Index) != len(e.via) {
+				continue // the embedded field itself is hidden
+			}
+			add(e.typ, sf.Index, e.via)
+		}
+	}
+	return result
+}
+
+func equalIndex(x, y []int) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// implements reports whether t and *t implement iface.
+func implements(t, iface reflect.Type) Interface {
+	result := Interface{
+		Name:    iface.String(),
+		Value:   t.Implements(iface),
+		Pointer: reflect.PtrTo(t).Implements(iface),
+	}
+	ms := methodSet(t)
+	for i := 0; i < iface.NumMethod(); i++ {
+		want := iface.Method(i)
+		wantSig := signature(want.Type, iface)
+		have, ok := ms.MethodByName(want.Name)
+		switch {
+		case !ok:
+			result.Missing = append(result.Missing, want.Name+wantSig)
+		case signature(have.Type, ms) != wantSig:
+			result.WrongType = append(result.WrongType, want.Name+": have "+
+				want.Name+signature(have.Type, ms)+", want "+want.Name+wantSig)
+		default:
+			if _, ok := t.MethodByName(want.Name); !ok {
+				result.PointerOnly = append(result.PointerOnly, want.Name)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,234 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package inspect_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"gopl.io/ch12/inspect"
+)
+
+type Base struct{ ID int }
+
+func (Base) String() string { return "base" }
+
+type Buffer struct {
+	Data []byte
+	ID   string // ambiguous with Base.ID, so not promoted into Record
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.Data = append(b.Data, p...)
+	return len(p), nil
+}
+
+type Record struct {
+	Name string `json:"name"`
+	Base
+	*Buffer
+	io.Reader
+	updated time.Time
+}
+
+func (r Record) Close() int { return 0 }
+
+var (
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	writerType   = reflect.TypeOf((*io.Writer)(nil)).Elem()
+	closerType   = reflect.TypeOf((*io.Closer)(nil)).Elem()
+	seekerType   = reflect.TypeOf((*io.Seeker)(nil)).Elem()
+)
+
+// printText prints the text form of r, less the field offsets,
+// which depend on GOARCH; TestOffsets checks those.
+func printText(r *inspect.Report) {
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	text := offsetNote.ReplaceAllString(buf.String(), "")
+	fmt.Print(lastOffsetNote.ReplaceAllString(text, ""))
+}
+
+var (
+	offsetNote     = regexp.MustCompile(`offset \d+, `)
+	lastOffsetNote = regexp.MustCompile(`( // |, )offset \d+`)
+)
+
+func Example() {
+	r := inspect.Of(Record{}, stringerType, writerType, closerType, seekerType)
+	printText(r)
+	// Output:
+	// type inspect_test.Record struct
+	// func (inspect_test.Record) Close() int
+	// func (inspect_test.Record) Read([]uint8) (int, error) // via Reader
+	// func (inspect_test.Record) String() string // via Base
+	// func (inspect_test.Record) Write([]uint8) (int, error) // via Buffer
+	// field Name string `json:"name"`
+	// field Base inspect_test.Base // embedded
+	// field Buffer *inspect_test.Buffer // embedded
+	// field Reader io.Reader // embedded
+	// field updated time.Time
+	// field Data []uint8 // via Buffer
+	// inspect_test.Record implements fmt.Stringer
+	// inspect_test.Record implements io.Writer
+	// inspect_test.Record does not implement io.Closer: wrong type for Close: have Close() int, want Close() error
+	// inspect_test.Record does not implement io.Seeker: missing Seek(int64, int) (int64, error)
+}
+
+func ExampleOf_pointerReceiver() {
+	printText(inspect.Of(Buffer{}, writerType))
+	// Output:
+	// type inspect_test.Buffer struct
+	// func (*inspect_test.Buffer) Write([]uint8) (int, error)
+	// field Data []uint8
+	// field ID string
+	// *inspect_test.Buffer implements io.Writer; inspect_test.Buffer does not: Write has a pointer receiver
+}
+
+func TestReport(t *testing.T) {
+	// A pointer type is reported as its element type.
+	r := inspect.Of(new(strings.Replacer))
+	if r.Type != "strings.Replacer" || r.Kind != "struct" {
+		t.Errorf("Of(*strings.Replacer) = %s %s", r.Type, r.Kind)
+	}
+	var names []string
+	for _, m := range r.Methods {
+		if !m.Pointer {
+			t.Errorf("%s.%s has a value receiver", r.Type, m.Name)
+		}
+		names = append(names, m.Name+m.Signature)
+	}
+	const want = "Replace(string) string WriteString(io.Writer, string) (int, error)"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("methods = %s, want %s", got, want)
+	}
+
+	// Interface types, and variadic methods.
+	type logger interface {
+		Logf(format string, args ...interface{})
+		io.Writer
+	}
+	r = inspect.Type(reflect.TypeOf((*logger)(nil)).Elem(), writerType, closerType)
+	names = nil
+	for _, m := range r.Methods {
+		names = append(names, m.Name+m.Signature)
+	}
+	if got, want := strings.Join(names, " "), "Logf(string, ...interface {}) Write([]uint8) (int, error)"; got != want {
+		t.Errorf("methods = %s, want %s", got, want)
+	}
+	if iface := r.Interfaces[0]; !iface.Value || iface.Pointer {
+		t.Errorf("logger implements io.Writer = %+v", iface)
+	}
+	if iface := r.Interfaces[1]; iface.Value || len(iface.Missing) != 1 {
+		t.Errorf("logger implements io.Closer = %+v", iface)
+	}
+
+	// Recursive embedding through a pointer terminates.
+	type node struct {
+		*node
+		Value int
+	}
+	r = inspect.Of(node{})
+	if len(r.Fields) != 2 {
+		t.Errorf("Of(node).Fields = %+v", r.Fields)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Type with non-interface candidate did not panic")
+		}
+	}()
+	inspect.Of(0, reflect.TypeOf(0))
+}
+
+func TestOffsets(t *testing.T) {
+	var r Record
+	want := map[string]uintptr{
+		"Name":    unsafe.Offsetof(r.Name),
+		"Base":    unsafe.Offsetof(r.Base),
+		"Buffer":  unsafe.Offsetof(r.Buffer),
+		"Reader":  unsafe.Offsetof(r.Reader),
+		"updated": unsafe.Offsetof(r.updated),
+		"Data":    unsafe.Offsetof(Buffer{}.Data), // within Buffer
+	}
+	fields := inspect.Of(r).Fields
+	if len(fields) != len(want) {
+		t.Fatalf("Of(Record).Fields = %+v", fields)
+	}
+	for _, f := range fields {
+		if f.Offset != want[f.Name] {
+			t.Errorf("field %s: offset %d, want %d", f.Name, f.Offset, want[f.Name])
+		}
+	}
+}
+
+// Shadow declares methods with the names of methods of its embedded fields.
+type Shadow struct {
+	Base
+	*Buffer
+}
+
+func (Shadow) String() string               { return "shadow" }
+func (*Shadow) Write(p []byte) (int, error) { return len(p), nil }
+func (Shadow) Read(p []byte) (int, error)   { return 0, io.EOF }
+
+type counter struct{}
+
+func (counter) Len() int { return 0 }
+func (counter) Reset()   {}
+
+type resetter struct{}
+
+func (resetter) Reset() {}
+
+// Mixed declares Len with another signature than counter's, and Reset,
+// which would otherwise be ambiguous; Write is promoted from Buffer.
+type Mixed struct {
+	counter
+	resetter
+	*Buffer
+}
+
+func (Mixed) Len() int64 { return 0 }
+func (Mixed) Reset()     {}
+
+func TestDeclaredMethods(t *testing.T) {
+	for _, test := range []struct {
+		x    interface{}
+		want string
+	}{
+		{Shadow{}, "Read[] String[] Write[]"},
+		{Mixed{}, "Len[] Reset[] Write[Buffer]"},
+	} {
+		var got []string
+		for _, m := range inspect.Of(test.x).Methods {
+			got = append(got, fmt.Sprintf("%s%v", m.Name, m.Via))
+		}
+		if s := strings.Join(got, " "); s != test.want {
+			t.Errorf("%T methods = %s, want %s", test.x, s, test.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := inspect.Of(&Record{}, closerType).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got inspect.Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := inspect.Of(Record{}, closerType); !reflect.DeepEqual(&got, want) {
+		t.Errorf("JSON round trip =\n%+v\nwant\n%+v", got, want)
+	}
+}
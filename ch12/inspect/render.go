@@ -0,0 +1,95 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText writes r to w in a Go-like textual form, such as:
+//
+//	type bufio.ReadWriter struct
+//	func (bufio.ReadWriter) Available() int // via Writer
+//	...
+//	field Reader *bufio.Reader // embedded, offset 0
+//	...
+//	bufio.ReadWriter implements io.Reader
+//	bufio.ReadWriter does not implement io.Closer: missing Close() error
+func (r *Report) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %s %s\n", r.Type, r.Kind)
+	for _, m := range r.Methods {
+		recv := r.Type
+		if m.Pointer {
+			recv = "*" + recv
+		}
+		fmt.Fprintf(&buf, "func (%s) %s%s", recv, m.Name, m.Signature)
+		if len(m.Via) > 0 {
+			fmt.Fprintf(&buf, " // via %s", strings.Join(m.Via, "."))
+		}
+		buf.WriteByte('\n')
+	}
+	for _, f := range r.Fields {
+		fmt.Fprintf(&buf, "field %s %s", f.Name, f.Type)
+		if f.Tag != "" {
+			fmt.Fprintf(&buf, " `%s`", f.Tag)
+		}
+		var notes []string
+		if f.Embedded {
+			notes = append(notes, "embedded")
+		}
+		notes = append(notes, fmt.Sprintf("offset %d", f.Offset))
+		if len(f.Via) > 0 {
+			notes = append(notes, "via "+strings.Join(f.Via, "."))
+		}
+		fmt.Fprintf(&buf, " // %s\n", strings.Join(notes, ", "))
+	}
+	for _, iface := range r.Interfaces {
+		buf.WriteString(iface.text(r.Type))
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// text describes whether the named type implements the interface.
+func (iface Interface) text(typ string) string {
+	switch {
+	case iface.Value:
+		return fmt.Sprintf("%s implements %s", typ, iface.Name)
+	case iface.Pointer:
+		return fmt.Sprintf("*%s implements %s; %s does not: %s %s a pointer receiver",
+			typ, iface.Name, typ, strings.Join(iface.PointerOnly, ", "),
+			plural(len(iface.PointerOnly), "has", "have"))
+	}
+	var reasons []string
+	for _, m := range iface.Missing {
+		reasons = append(reasons, "missing "+m)
+	}
+	for _, m := range iface.WrongType {
+		reasons = append(reasons, "wrong type for "+m)
+	}
+	return fmt.Sprintf("%s does not implement %s: %s", typ, iface.Name, strings.Join(reasons, "; "))
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// WriteJSON writes r to w as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
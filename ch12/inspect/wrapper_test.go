@@ -0,0 +1,33 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package inspect
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+type inner struct{}
+
+func (inner) M() {}
+
+type outer struct{ inner }
+
+func (outer) N() {}
+
+// TestAutogeneratedWrappers checks the assumption on which declared
+// depends: that the runtime reports the compiler-generated wrapper of
+// a promoted method, and only that, as "<autogenerated>".
+func TestAutogeneratedWrappers(t *testing.T) {
+	for _, typ := range []reflect.Type{reflect.TypeOf(outer{}), reflect.TypeOf(&outer{})} {
+		m, _ := typ.MethodByName("M")
+		n, _ := typ.MethodByName("N")
+		if !isWrapper(m.Func.Pointer()) || typ.Kind() == reflect.Struct && isWrapper(n.Func.Pointer()) {
+			t.Fatalf("%s does not mark the wrappers of promoted methods such as %s.M "+
+				"as <autogenerated>, so inspect cannot tell declared methods from promoted ones",
+				runtime.Version(), typ)
+		}
+	}
+}
@@ -4,6 +4,9 @@
 // See page 351.
 
 // Package methods provides a function to print the methods of any value.
+//
+// See gopl.io/ch12/inspect for a more complete description of a type,
+// including its fields and the interfaces it implements.
 package methods
 
 import (
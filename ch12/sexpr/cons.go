@@ -0,0 +1,352 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode"
+)
+
+// A Cons is a Lisp pair, written (car . cdr). A dotted list such as
+// (1 2 . 3) is a chain of pairs, &Cons{1, &Cons{2, 3}}.
+//
+// Unlike other Go values, the fields of a Cons hold data decoded
+// without a target type: each is a Value.
+//
+// A Cons is decoded from any nonempty list, and encodes itself
+// as a dotted list unless its final cdr is nil or a list.
+type Cons struct {
+	Car, Cdr Value
+}
+
+var symbolType = reflect.TypeOf(Symbol(""))
+
+// MarshalSExpr encodes c in list notation.
+func (c Cons) MarshalSExpr() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeDatum(&buf, &c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalSExpr decodes a nonempty list into c.
+func (c *Cons) UnmarshalSExpr(data []byte) error {
+	d := &decodeState{lex: newLexer(bytes.NewReader(data))}
+	d.lex.next()
+	pos := d.lex.pos
+	x, err := d.readDatum()
+	if err != nil {
+		return err
+	}
+	switch x := x.(type) {
+	case *Cons:
+		*c = *x
+		return nil
+	case List:
+		if len(x) > 0 {
+			*c = *listToCons(x, nil)
+			return nil
+		}
+	}
+	return d.typeError("atom or empty list", reflect.TypeOf(c).Elem(), pos)
+}
+
+// listToCons returns the chain of pairs holding elems, ending in tail.
+func listToCons(elems List, tail Value) *Cons {
+	for i := len(elems) - 1; i >= 0; i-- {
+		tail = &Cons{elems[i], tail}
+	}
+	return tail.(*Cons)
+}
+
+// writeDatum writes x, a Value.
+// Values of other types are encoded as by Marshal.
+func writeDatum(buf *bytes.Buffer, x Value) error {
+	switch x := x.(type) {
+	case nil:
+		buf.WriteString("nil")
+	case Symbol:
+		if !isSymbol(string(x)) {
+			return fmt.Errorf("sexpr: invalid symbol %q", string(x))
+		}
+		buf.WriteString(string(x))
+	case String:
+		buf.WriteString(strconv.Quote(string(x)))
+	case Int:
+		fmt.Fprintf(buf, "%d", x)
+	case Float:
+		buf.WriteString(formatFloat(float64(x), 64))
+	case List:
+		buf.WriteByte('(')
+		for i, elem := range x {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			if err := writeDatum(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(')')
+	case Cons:
+		return writeDatum(buf, &x)
+	case *Cons:
+		if x == nil {
+			buf.WriteString("nil")
+			break
+		}
+		buf.WriteByte('(')
+		for {
+			if err := writeDatum(buf, x.Car); err != nil {
+				return err
+			}
+			switch cdr := x.Cdr.(type) {
+			case nil:
+			case *Cons:
+				if cdr != nil {
+					buf.WriteByte(' ')
+					x = cdr
+					continue
+				}
+			case List:
+				for _, elem := range cdr {
+					buf.WriteByte(' ')
+					if err := writeDatum(buf, elem); err != nil {
+						return err
+					}
+				}
+			default:
+				buf.WriteString(" . ")
+				if err := writeDatum(buf, cdr); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		buf.WriteByte(')')
+	default:
+		data, err := Marshal(x)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+// readDatum reads a Value.
+func (d *decodeState) readDatum() (Value, error) {
+	lex := d.lex
+	if lex.err != "" {
+		return nil, d.syntaxError("%s", lex.err)
+	}
+	pos := lex.pos
+	switch lex.token {
+	case scanner.Ident:
+		text := lex.text()
+		switch text {
+		case "nil":
+			lex.next()
+			return nil, nil
+		case "NaN", "Inf":
+			return d.readDatumNumber(pos, "")
+		}
+		return d.readSymbol(), nil
+	case scanner.String, scanner.RawString:
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return nil, d.syntaxError("invalid string %s", lex.text())
+		}
+		lex.next()
+		return String(s), nil
+	case scanner.Int, scanner.Float, radixInt:
+		return d.readDatumNumber(pos, "")
+	case '-', '+':
+		// A sign begins a symbol unless a number immediately follows.
+		sign := lex.text()
+		lex.next()
+		isNum := lex.token == scanner.Int || lex.token == scanner.Float ||
+			lex.token == scanner.Ident && (lex.text() == "Inf" || lex.text() == "NaN")
+		if isNum && lex.pos.Offset == pos.Offset+1 {
+			return d.readDatumNumber(pos, sign)
+		}
+		return d.continueSymbol(sign, pos.Offset+1), nil
+	case '#':
+		lex.next()
+		if lex.token == scanner.Int {
+			return d.readDatumLabel(pos)
+		}
+		if lex.token != scanner.Ident || lex.text() != "C" {
+			return nil, syntaxErrorAt(pos, "unsupported syntax #%s in generic value", lex.text())
+		}
+		var c complex128
+		if err := d.readComplex(reflect.ValueOf(&c).Elem(), pos); err != nil {
+			return nil, err
+		}
+		return c, nil
+	case '\'':
+		lex.next()
+		x, err := d.readDatum()
+		if err != nil {
+			return nil, err
+		}
+		return List{Symbol("quote"), x}, nil
+	case '(':
+		lex.next()
+		elems := List{}
+		for {
+			end, err := d.endList()
+			if err != nil {
+				return nil, err
+			}
+			if end {
+				lex.next()
+				return elems, nil
+			}
+			if lex.token == '.' {
+				if len(elems) == 0 {
+					return nil, d.syntaxError("unexpected . at start of list")
+				}
+				lex.next()
+				tail, err := d.readDatum()
+				if err != nil {
+					return nil, err
+				}
+				if err := d.consume(')'); err != nil {
+					return nil, err
+				}
+				return listToCons(elems, tail), nil
+			}
+			elem, err := d.readDatum()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+	case scanner.EOF:
+		return nil, d.syntaxError("unexpected end of input")
+	case ')', '.':
+		return nil, d.syntaxError("unexpected %s", lex.describe())
+	}
+	// Any other punctuation, such as * or <=, begins a symbol.
+	return d.readSymbol(), nil
+}
+
+// readDatumLabel reads a labelled Value, #n=value, or a reference to
+// one, #n#, whose # is at pos. A reference yields the labelled Value
+// itself, so shared structure is preserved, but a reference within
+// the Value it refers to, a cycle, is an error, since a Value
+// cannot be allocated before it is read as a pointer can.
+func (d *decodeState) readDatumLabel(pos scanner.Position) (Value, error) {
+	lex := d.lex
+	n, err := strconv.Atoi(lex.text())
+	if err != nil {
+		return nil, d.syntaxError("invalid label #%s", lex.text())
+	}
+	lex.next()
+	switch lex.token {
+	case '=':
+		lex.next()
+		if _, ok := d.datums[n]; ok {
+			return nil, syntaxErrorAt(pos, "duplicate label #%d=", n)
+		}
+		if d.datums == nil {
+			d.datums = make(map[int]*Value)
+		}
+		d.datums[n] = nil // being read
+		x, err := d.readDatum()
+		if err != nil {
+			return nil, err
+		}
+		d.datums[n] = &x
+		return x, nil
+	case '#':
+		lex.next()
+		x, ok := d.datums[n]
+		if !ok {
+			return nil, syntaxErrorAt(pos, "undefined label #%d#", n)
+		}
+		if x == nil {
+			return nil, syntaxErrorAt(pos, "cyclic reference #%d# in generic value", n)
+		}
+		return *x, nil
+	}
+	return nil, d.syntaxError("got %s after #%d, want = or #", lex.describe(), n)
+}
+
+// readSymbol reads a symbol. Since the lexer scans Go tokens,
+// a symbol such as foo-bar or <= is a run of adjacent tokens.
+func (d *decodeState) readSymbol() Symbol {
+	text := d.lex.text()
+	end := d.lex.pos.Offset + len(text)
+	d.lex.next()
+	return d.continueSymbol(text, end)
+}
+
+// continueSymbol reads the rest of the symbol that begins with text
+// and ends, so far, at offset end.
+func (d *decodeState) continueSymbol(text string, end int) Symbol {
+	lex := d.lex
+	for lex.pos.Offset == end && isSymbolToken(lex.token) {
+		text += lex.text()
+		end += len(lex.text())
+		lex.next()
+	}
+	return Symbol(text)
+}
+
+// isSymbolToken reports whether tok may be part of a symbol.
+func isSymbolToken(tok rune) bool {
+	return tok == scanner.Ident || tok == scanner.Int ||
+		tok > 0 && !strings.ContainsRune(delimiters, tok)
+}
+
+// delimiters are the characters that may not appear in a symbol.
+const delimiters = "()'\";#.|`, \t\n\r"
+
+// isSymbol reports whether s can be written as a symbol
+// that reads back as itself.
+func isSymbol(s string) bool {
+	if s == "" || s == "nil" || strings.ContainsAny(s, delimiters) {
+		return false
+	}
+	switch t := strings.TrimLeft(s, "+-"); {
+	case t == "Inf" || t == "NaN", t != "" && unicode.IsDigit(rune(t[0])):
+		return false // a number
+	}
+	for _, r := range s {
+		if r > unicode.MaxASCII && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// readDatumNumber reads a number as an Int or a Float.
+// If sign is set, the sign has already been consumed.
+func (d *decodeState) readDatumNumber(pos scanner.Position, sign string) (Value, error) {
+	isInt := d.lex.token != scanner.Float && d.lex.token != scanner.Ident
+	text, err := d.readNumber()
+	if err != nil {
+		return nil, err
+	}
+	text = sign + text
+	if isInt {
+		var i int64
+		if err := d.setNumber(reflect.ValueOf(&i).Elem(), text, pos); err != nil {
+			return nil, err
+		}
+		return Int(i), nil
+	}
+	var f float64
+	if err := d.setNumber(reflect.ValueOf(&f).Elem(), text, pos); err != nil {
+		return nil, err
+	}
+	return Float(f), nil
+}
@@ -0,0 +1,159 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A value that contains itself, through a pointer, map or slice,
+// has no finite S-expression, so by default encoding it fails.
+//
+// With labels enabled, a pointer that is reached more than once,
+// whether because it is shared or because it is part of a cycle,
+// is written in full only the first time, prefixed by a label,
+// as in Common Lisp:
+//
+//	#1=((Name "a") (Next ((Name "b") (Next #1#))))
+//
+// and thereafter as a reference, #1#. The decoder sets every
+// reference to the same pointer as its label, so shared and cyclic
+// structures round-trip. Decoded as a Value, a shared structure
+// keeps its sharing, but a cyclic one is an error. A cycle that
+// passes through no pointer, such as a map that contains itself
+// as an interface value, is still an error.
+
+// An encoder holds the state of a single call to Marshal or MarshalIndent.
+type encoder struct {
+	labels map[ref]int  // shared pointers and their labels, 0 until written
+	last   int          // last label written
+	active map[ref]bool // pointers, maps and slices being encoded
+}
+
+// A ref identifies the referent of a pointer, map or slice.
+type ref struct {
+	ptr uintptr
+	typ reflect.Type // distinguishes a struct from its first field
+	len int          // distinguishes a slice from its prefixes
+}
+
+func refOf(v reflect.Value) ref {
+	r := ref{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		r.len = v.Len()
+	}
+	return r
+}
+
+// newEncoder returns an encoder for v. If labels is set,
+// it labels the pointers that v reaches more than once.
+func newEncoder(v reflect.Value, labels bool) *encoder {
+	enc := &encoder{active: make(map[ref]bool)}
+	if labels {
+		counts := make(map[ref]int)
+		countRefs(v, counts, make(map[ref]bool))
+		enc.labels = make(map[ref]int)
+		for r, n := range counts {
+			if n > 1 {
+				enc.labels[r] = 0
+			}
+		}
+	}
+	return enc
+}
+
+// countRefs counts the references to each pointer that
+// encoding v would follow, following each pointer once.
+func countRefs(v reflect.Value, counts map[ref]int, active map[ref]bool) {
+	if _, ok := marshalerValue(v); ok {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		r := refOf(v)
+		if counts[r]++; counts[r] == 1 {
+			countRefs(v.Elem(), counts, active)
+		}
+
+	case reflect.Interface:
+		if !v.IsNil() {
+			countRefs(v.Elem(), counts, active)
+		}
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			countRefs(v.Index(i), counts, active)
+		}
+
+	case reflect.Slice:
+		if v.Len() == 0 || active[refOf(v)] {
+			return // empty, or a cycle for encode to report
+		}
+		active[refOf(v)] = true
+		for i := 0; i < v.Len(); i++ {
+			countRefs(v.Index(i), counts, active)
+		}
+		delete(active, refOf(v))
+
+	case reflect.Struct:
+		for _, f := range structFields(v.Type()) {
+			if fv := fieldByIndex(v, f.index); fv.IsValid() && !(f.omitEmpty && isEmptyValue(fv)) {
+				countRefs(fv, counts, active)
+			}
+		}
+
+	case reflect.Map:
+		if v.IsNil() || active[refOf(v)] {
+			return
+		}
+		active[refOf(v)] = true
+		for iter := v.MapRange(); iter.Next(); {
+			countRefs(iter.Key(), counts, active)
+			countRefs(iter.Value(), counts, active)
+		}
+		delete(active, refOf(v))
+	}
+}
+
+// isRef reports whether v is a non-nil pointer, map or nonempty slice,
+// which the encoder must visit.
+func isRef(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map:
+		return !v.IsNil()
+	case reflect.Slice:
+		return v.Len() > 0
+	}
+	return false
+}
+
+// visit records that the encoding of the non-nil pointer, map or
+// slice v is beginning. If v is a shared pointer whose label has been
+// written already, visit returns the reference #n# and done is set;
+// otherwise the caller must encode v, preceded by the returned label,
+// #n=, if any, and then call leave.
+func (enc *encoder) visit(v reflect.Value) (label string, done bool, err error) {
+	r := refOf(v)
+	if n, ok := enc.labels[r]; ok {
+		if n > 0 {
+			return fmt.Sprintf("#%d#", n), true, nil
+		}
+		enc.last++
+		enc.labels[r] = enc.last
+		label = fmt.Sprintf("#%d=", enc.last)
+	} else if enc.active[r] {
+		return "", false, fmt.Errorf("sexpr: encountered a cycle via %s", v.Type())
+	}
+	enc.active[r] = true
+	return label, false, nil
+}
+
+// leave records that the encoding of v, begun by visit, is complete.
+func (enc *encoder) leave(v reflect.Value) {
+	delete(enc.active, refOf(v))
+}
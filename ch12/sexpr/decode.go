@@ -10,153 +10,799 @@ package sexpr
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
+	"strings"
 	"text/scanner"
+	"unicode"
 )
 
 //!+Unmarshal
 // Unmarshal parses S-expression data and populates the variable
-// whose address is in the non-nil pointer out.
-func Unmarshal(data []byte, out interface{}) (err error) {
-	lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
-	lex.scan.Init(bytes.NewReader(data))
+// whose address is in the non-nil pointer out. If out is
+// a *interface{}, Unmarshal stores a Value in it.
+//
+// The data must hold exactly one S-expression. Malformed data is
+// reported as a *SyntaxError, data that does not fit the type of
+// the variable as an *UnmarshalTypeError, and a struct field that
+// the Go struct type lacks as an *UnknownFieldError.
+func Unmarshal(data []byte, out interface{}) error {
+	return UnmarshalOptions{}.Unmarshal(data, out)
+}
+
+//!-Unmarshal
+
+// UnmarshalOptions configures the decoding of Unmarshal.
+// The zero value gives the behavior of Unmarshal.
+type UnmarshalOptions struct {
+	// IgnoreUnknownFields causes struct fields that are absent from,
+	// or unexported in, the destination type to be skipped, instead
+	// of reported as an *UnknownFieldError.
+	IgnoreUnknownFields bool
+
+	// IgnoreFieldCase causes field names that differ from the struct
+	// field names, or their tagged names, only in case, such as title
+	// for Title, to match. Exact matches are preferred.
+	IgnoreFieldCase bool
+}
+
+// Unmarshal is like the Unmarshal function, but decodes as
+// specified by opts.
+func (opts UnmarshalOptions) Unmarshal(data []byte, out interface{}) error {
+	lex := newLexer(bytes.NewReader(data))
 	lex.next() // get the first token
-	defer func() {
-		// NOTE: this is not an example of ideal error handling.
-		if x := recover(); x != nil {
-			err = fmt.Errorf("error at %s: %v", lex.scan.Position, x)
-		}
-	}()
-	read(lex, reflect.ValueOf(out).Elem())
+	d := &decodeState{lex: lex, ignoreUnknown: opts.IgnoreUnknownFields, foldNames: opts.IgnoreFieldCase}
+	if err := d.unmarshal(out); err != nil {
+		return err
+	}
+	if lex.token != scanner.EOF {
+		return d.syntaxError("unexpected %s after top-level value", lex.describe())
+	}
 	return nil
 }
 
-//!-Unmarshal
+// A SyntaxError describes malformed S-expression input.
+type SyntaxError struct {
+	Msg          string
+	Line, Column int // position of the offending token
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("sexpr: syntax error at %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// An UnmarshalTypeError describes an S-expression value that
+// cannot be stored in a Go variable of a particular type.
+type UnmarshalTypeError struct {
+	Value        string       // description of the input, e.g., "string" or "number -1"
+	Type         reflect.Type // type of the Go variable
+	Field        string       // path from the root to the variable, e.g., Actor["Dr. No"]
+	Line, Column int          // position of the value
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("sexpr: cannot unmarshal %s into Go struct field %s of type %s (at %d:%d)",
+			e.Value, e.Field, e.Type, e.Line, e.Column)
+	}
+	return fmt.Sprintf("sexpr: cannot unmarshal %s into Go value of type %s (at %d:%d)",
+		e.Value, e.Type, e.Line, e.Column)
+}
+
+// An UnknownFieldError describes a field of an S-expression struct
+// that the Go struct type lacks, or has only as an unexported field.
+type UnknownFieldError struct {
+	Name         string       // name of the field in the input
+	Type         reflect.Type // the Go struct type
+	Path         string       // path from the root to the struct, e.g., Actor["Dr. No"]
+	Line, Column int          // position of the field name
+}
+
+func (e *UnknownFieldError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("sexpr: unknown field %s in Go struct %s of type %s (at %d:%d)",
+			e.Name, e.Path, e.Type, e.Line, e.Column)
+	}
+	return fmt.Sprintf("sexpr: unknown field %s in Go struct type %s (at %d:%d)",
+		e.Name, e.Type, e.Line, e.Column)
+}
 
 //!+lexer
 type lexer struct {
 	scan  scanner.Scanner
-	token rune // the current token
+	token rune             // the current token
+	pos   scanner.Position // position of the current token
+	lit   string           // text of the current token, if it is radixInt
+	err   string           // first error reported by scan, if any
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
-func (lex *lexer) text() string { return lex.scan.TokenText() }
+// radixInt is the token for an integer in Common Lisp radix
+// syntax, such as #x1F, #b-101 or #o17.
+const radixInt = -100
 
-func (lex *lexer) consume(want rune) {
-	if lex.token != want { // NOTE: Not an example of good error handling.
-		panic(fmt.Sprintf("got %q, want %q", lex.text(), want))
+func newLexer(r io.Reader) *lexer {
+	lex := new(lexer)
+	lex.init(r)
+	return lex
+}
+
+func (lex *lexer) init(r io.Reader) {
+	lex.scan.Init(r)
+	// Go comments and character literals are not Lisp syntax.
+	lex.scan.Mode = scanner.ScanIdents | scanner.ScanFloats |
+		scanner.ScanStrings | scanner.ScanRawStrings
+	lex.scan.Error = func(_ *scanner.Scanner, msg string) {
+		lex.error(msg)
+	}
+}
+
+func (lex *lexer) error(msg string) {
+	if lex.err == "" {
+		lex.err = msg
+	}
+}
+
+// next scans the next token, skipping ; line comments and
+// #| block comments |#, and combining the characters of a
+// radix integer into a single token.
+func (lex *lexer) next() {
+	for {
+		lex.token = lex.scan.Scan()
+		lex.pos = lex.scan.Position // Next invalidates scan.Position
+		switch {
+		case lex.token == ';':
+			for ch := lex.scan.Peek(); ch != '\n' && ch != scanner.EOF; ch = lex.scan.Peek() {
+				lex.scan.Next()
+			}
+			continue
+		case lex.token == '#' && lex.scan.Peek() == '|':
+			lex.skipBlockComment()
+			continue
+		case lex.token == '#' && strings.ContainsRune("xXbBoO", lex.scan.Peek()):
+			lex.scanRadixInt()
+		}
+		return
+	}
+}
+
+func (lex *lexer) text() string {
+	if lex.token == radixInt {
+		return lex.lit
+	}
+	return lex.scan.TokenText()
+}
+
+// skipBlockComment skips a block comment, which may be nested,
+// after its opening #.
+func (lex *lexer) skipBlockComment() {
+	lex.scan.Next() // consume '|'
+	depth := 1
+	for prev := rune(0); depth > 0; {
+		ch := lex.scan.Next()
+		switch {
+		case ch == scanner.EOF:
+			lex.error("comment not terminated")
+			return
+		case prev == '|' && ch == '#':
+			depth--
+			ch = 0 // "|#|" does not begin another comment
+		case prev == '#' && ch == '|':
+			depth++
+			ch = 0
+		}
+		prev = ch
+	}
+}
+
+// scanRadixInt scans the rest of a radix integer after its #.
+func (lex *lexer) scanRadixInt() {
+	var buf strings.Builder
+	buf.WriteByte('#')
+	buf.WriteRune(lex.scan.Next()) // the radix
+	if ch := lex.scan.Peek(); ch == '-' || ch == '+' {
+		buf.WriteRune(lex.scan.Next())
+	}
+	digits := false
+	for ch := lex.scan.Peek(); unicode.IsLetter(ch) || unicode.IsDigit(ch); ch = lex.scan.Peek() {
+		buf.WriteRune(lex.scan.Next())
+		digits = true
+	}
+	lex.token = radixInt
+	lex.lit = buf.String()
+	if !digits {
+		lex.error("missing digits in " + lex.lit)
 	}
-	lex.next()
+}
+
+// radixToDecimal converts a radix integer to decimal notation.
+func radixToDecimal(text string) (string, error) {
+	base := map[byte]int{'x': 16, 'X': 16, 'b': 2, 'B': 2, 'o': 8, 'O': 8}[text[1]]
+	digits, sign := text[2:], ""
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		digits, sign = digits[1:], digits[:1]
+	}
+	u, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid integer %s", text)
+	}
+	if sign == "-" {
+		return "-" + strconv.FormatUint(u, 10), nil
+	}
+	return strconv.FormatUint(u, 10), nil
+}
+
+// describe returns a string describing the current token, for use in errors.
+func (lex *lexer) describe() string {
+	if lex.token == scanner.EOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", lex.text())
 }
 
 //!-lexer
 
-// The read function is a decoder for a small subset of well-formed
-// S-expressions.  For brevity of our example, it takes many dubious
-// shortcuts.
+// A decodeState holds the state of a single call to Unmarshal or Decode.
+type decodeState struct {
+	lex           *lexer
+	path          []string              // path from the root to the current variable
+	ignoreUnknown bool                  // whether to skip unknown struct fields
+	foldNames     bool                  // whether field names match case-insensitively
+	labels        map[int]reflect.Value // pointers labelled by #n=
+	datums        map[int]*Value        // generic values labelled by #n=, nil while being read
+}
+
+func (d *decodeState) unmarshal(out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("sexpr: Unmarshal(non-pointer or nil %T)", out)
+	}
+	if v := v.Elem(); isValue(v) {
+		x, err := d.readDatum()
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+	return d.read(v.Elem())
+}
+
+func (d *decodeState) syntaxError(format string, args ...interface{}) error {
+	return syntaxErrorAt(d.lex.pos, format, args...)
+}
+
+func syntaxErrorAt(pos scanner.Position, format string, args ...interface{}) error {
+	return &SyntaxError{fmt.Sprintf(format, args...), pos.Line, pos.Column}
+}
+
+func (d *decodeState) typeError(value string, t reflect.Type, pos scanner.Position) error {
+	return &UnmarshalTypeError{value, t, strings.TrimPrefix(strings.Join(d.path, ""), "."), pos.Line, pos.Column}
+}
+
+// with calls f with elem appended to the path.
+func (d *decodeState) with(elem string, f func() error) error {
+	d.path = append(d.path, elem)
+	err := f()
+	d.path = d.path[:len(d.path)-1]
+	return err
+}
+
+func (d *decodeState) consume(want rune) error {
+	if d.lex.token != want {
+		return d.syntaxError("got %s, want %q", d.lex.describe(), want)
+	}
+	d.lex.next()
+	return nil
+}
+
+// The read method is a decoder for a subset of S-expressions.
 //
+// The lexer skips ; line comments and #| block comments |#,
+// and the parser accepts integers in radix syntax, such as #x1F.
 // The parser assumes
-// - that the S-expression input is well-formed; it does no error checking.
-// - that the S-expression input corresponds to the type of the variable.
-// - that all numbers in the input are non-negative decimal integers.
 // - that all keys in ((key value) ...) struct syntax are unquoted symbols.
-// - that the input does not contain dotted lists such as (1 2 . 3).
-// - that the input does not contain Lisp reader macros such 'x and #'x.
+// - that the input contains dotted lists such as (1 2 . 3), and quoted
+//   values such as 'x, only where a Cons is expected, or as 'nil
+//   for a non-nil pointer to a value written as nil, such as false.
+// - that the input does not contain Lisp reader macros such #'x,
+//   other than the complex number syntax #C(re im) and labels #n= and #n#.
 //
-// The reflection logic assumes
-// - that v is always a variable of the appropriate type for the
-//   S-expression value.  For example, v must not be a boolean,
-//   interface, channel, or function, and if v is an array, the input
-//   must have the correct number of elements.
-// - that v in the top-level call to read has the zero value of its
-//   type and doesn't need clearing.
-// - that if v is a numeric variable, it is a signed integer.
+// Struct field names are matched as described at structFields,
+// falling back to case-insensitive matching if foldNames is set.
+// Fields that are unexported or absent from the Go type are
+// reported as errors unless ignoreUnknown is set.
 
 //!+read
-func read(lex *lexer, v reflect.Value) {
+func (d *decodeState) read(v reflect.Value) error {
+	lex := d.lex
+	if lex.err != "" {
+		return d.syntaxError("%s", lex.err)
+	}
+	if lex.token == '#' {
+		return d.readSharp(v)
+	}
+	if v.Kind() == reflect.Ptr && !(lex.token == scanner.Ident && lex.text() == "nil") {
+		// Pointers are implicit in the encoding, except that a quote
+		// marks a pointer to a value written as nil, as in 'nil,
+		// unless the pointer decodes itself, as a *Cons does.
+		if lex.token == '\'' && !v.Type().Implements(unmarshalerType) {
+			lex.next()
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.read(v.Elem())
+	}
+	if ok, err := d.unmarshalCustom(v); ok {
+		return err
+	}
+	pos := lex.pos
+	if v.Type() == symbolType {
+		x, err := d.readDatum()
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.SetString("")
+			return nil
+		}
+		if _, ok := x.(Symbol); !ok {
+			return d.typeError(fmt.Sprintf("%T value", x), v.Type(), pos)
+		}
+		v.Set(reflect.ValueOf(x))
+		return nil
+	}
 	switch lex.token {
 	case scanner.Ident:
 		// The only valid identifiers are
-		// "nil" and struct field names.
-		if lex.text() == "nil" {
+		// "nil", "t", "NaN", "Inf" and struct field names.
+		switch lex.text() {
+		case "nil":
 			v.Set(reflect.Zero(v.Type()))
 			lex.next()
-			return
+			return nil
+		case "t":
+			if v.Kind() != reflect.Bool {
+				return d.typeError("symbol t", v.Type(), pos)
+			}
+			v.SetBool(true)
+			lex.next()
+			return nil
+		case "NaN", "Inf":
+			text, err := d.readNumber()
+			if err != nil {
+				return err
+			}
+			return d.setNumber(v, text, pos)
+		}
+		return d.typeError("symbol "+lex.text(), v.Type(), pos)
+	case scanner.String, scanner.RawString:
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return d.syntaxError("invalid string %s", lex.text())
+		}
+		if v.Kind() != reflect.String {
+			return d.typeError("string", v.Type(), pos)
 		}
-	case scanner.String:
-		s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
 		v.SetString(s)
 		lex.next()
-		return
-	case scanner.Int:
-		i, _ := strconv.Atoi(lex.text()) // NOTE: ignoring errors
-		v.SetInt(int64(i))
-		lex.next()
-		return
+		return nil
+	case scanner.Int, scanner.Float, radixInt, '-', '+':
+		text, err := d.readNumber()
+		if err != nil {
+			return err
+		}
+		return d.setNumber(v, text, pos)
 	case '(':
 		lex.next()
-		readList(lex, v)
-		lex.next() // consume ')'
-		return
+		var err error
+		if v.Kind() == reflect.Interface {
+			err = d.readInterface(v)
+		} else {
+			err = d.readList(v, pos)
+		}
+		if err != nil {
+			return err
+		}
+		return d.consume(')')
 	}
-	panic(fmt.Sprintf("unexpected token %q", lex.text()))
+	return d.syntaxError("unexpected %s", lex.describe())
 }
 
 //!-read
 
+// readNumber consumes an optionally signed number,
+// which may be Inf or NaN, and returns its text.
+// A sign must immediately precede the digits, as in the
+// generic decoder, which reads a separated sign as a symbol.
+// A radix integer is converted to decimal.
+func (d *decodeState) readNumber() (string, error) {
+	lex := d.lex
+	var sign string
+	if lex.token == '-' || lex.token == '+' {
+		sign = lex.text()
+		end := lex.pos.Offset + 1
+		lex.next()
+		if lex.token != scanner.EOF && lex.pos.Offset != end {
+			return "", d.syntaxError("got %s after sign %s, want adjacent number", lex.describe(), sign)
+		}
+	}
+	switch {
+	case lex.token == radixInt && sign == "":
+		text, err := radixToDecimal(lex.text())
+		if err != nil {
+			return "", d.syntaxError("%v", err)
+		}
+		lex.next()
+		return text, nil
+	case lex.token == scanner.Int, lex.token == scanner.Float,
+		lex.token == scanner.Ident && (lex.text() == "Inf" || lex.text() == "NaN"):
+		text := sign + lex.text()
+		lex.next()
+		return text, nil
+	}
+	return "", d.syntaxError("got %s, want number", lex.describe())
+}
+
+// setNumber sets the numeric variable v to the number denoted by text.
+func (d *decodeState) setNumber(v reflect.Value, text string, pos scanner.Position) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || v.OverflowInt(i) {
+			break
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(text, 10, 64)
+		if err != nil || v.OverflowUint(u) {
+			break
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			break
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Complex64, reflect.Complex128:
+		f, err := strconv.ParseFloat(text, v.Type().Bits()/2)
+		if err != nil {
+			break
+		}
+		v.SetComplex(complex(f, 0))
+		return nil
+	}
+	return d.typeError("number "+text, v.Type(), pos)
+}
+
+// readSharp reads a value that begins with #: a complex number,
+// #C(re im), a labelled pointer, #n=value, or a reference to
+// a labelled pointer, #n#.
+func (d *decodeState) readSharp(v reflect.Value) error {
+	lex := d.lex
+	pos := lex.pos
+	lex.next() // consume '#'
+	if lex.token != scanner.Int {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		return d.readComplex(v, pos)
+	}
+	n, err := strconv.Atoi(lex.text())
+	if err != nil {
+		return d.syntaxError("invalid label #%s", lex.text())
+	}
+	lex.next()
+	switch lex.token {
+	case '=':
+		lex.next()
+		if v.Kind() != reflect.Ptr {
+			return d.typeError(fmt.Sprintf("labelled value #%d=", n), v.Type(), pos)
+		}
+		if _, ok := d.labels[n]; ok {
+			return syntaxErrorAt(pos, "duplicate label #%d=", n)
+		}
+		if d.labels == nil {
+			d.labels = make(map[int]reflect.Value)
+		}
+		// Allocate the pointer before reading its referent,
+		// which may refer to it.
+		ptr := reflect.New(v.Type().Elem())
+		d.labels[n] = ptr
+		v.Set(ptr)
+		return d.read(ptr.Elem())
+	case '#':
+		lex.next()
+		ptr, ok := d.labels[n]
+		if !ok {
+			return syntaxErrorAt(pos, "undefined label #%d#", n)
+		}
+		if !ptr.Type().AssignableTo(v.Type()) {
+			return d.typeError(fmt.Sprintf("reference #%d# to %s", n, ptr.Type()), v.Type(), pos)
+		}
+		v.Set(ptr)
+		return nil
+	}
+	return d.syntaxError("got %s after #%d, want = or #", lex.describe(), n)
+}
+
+// readComplex reads a complex number, #C(re im), whose # is at pos, into v.
+func (d *decodeState) readComplex(v reflect.Value, pos scanner.Position) error {
+	lex := d.lex
+	if lex.token != scanner.Ident || lex.text() != "C" {
+		return d.syntaxError("got %s after #, want C", lex.describe())
+	}
+	lex.next()
+	if err := d.consume('('); err != nil {
+		return err
+	}
+	re, err := d.readNumber()
+	if err != nil {
+		return err
+	}
+	im, err := d.readNumber()
+	if err != nil {
+		return err
+	}
+	if err := d.consume(')'); err != nil {
+		return err
+	}
+	value := fmt.Sprintf("complex number #C(%s %s)", re, im)
+	if v.Kind() != reflect.Complex64 && v.Kind() != reflect.Complex128 {
+		return d.typeError(value, v.Type(), pos)
+	}
+	bits := v.Type().Bits() / 2
+	r, err1 := strconv.ParseFloat(re, bits)
+	i, err2 := strconv.ParseFloat(im, bits)
+	if err1 != nil || err2 != nil {
+		return d.typeError(value, v.Type(), pos)
+	}
+	v.SetComplex(complex(r, i))
+	return nil
+}
+
+// readInterface reads the remainder of an interface value,
+// ("type" value), into v, after its opening '('.
+func (d *decodeState) readInterface(v reflect.Value) error {
+	lex := d.lex
+	if lex.token != scanner.String {
+		return d.syntaxError("got %s, want type name", lex.describe())
+	}
+	name, err := strconv.Unquote(lex.text())
+	if err != nil {
+		return d.syntaxError("invalid string %s", lex.text())
+	}
+	t, ok := typeByName(name)
+	if !ok {
+		return d.typeError(fmt.Sprintf("value of unregistered type %q", name), v.Type(), lex.pos)
+	}
+	if !t.AssignableTo(v.Type()) {
+		return d.typeError(fmt.Sprintf("value of type %s", t), v.Type(), lex.pos)
+	}
+	lex.next()
+	elem := reflect.New(t).Elem()
+	if err := d.read(elem); err != nil {
+		return err
+	}
+	v.Set(elem)
+	return nil
+}
+
 //!+readlist
-func readList(lex *lexer, v reflect.Value) {
+// readList reads the elements of a list, which began at pos, into v.
+func (d *decodeState) readList(v reflect.Value, pos scanner.Position) error {
+	lex := d.lex
 	switch v.Kind() {
 	case reflect.Array: // (item ...)
-		for i := 0; !endList(lex); i++ {
-			read(lex, v.Index(i))
+		i := 0
+		for ; ; i++ {
+			end, err := d.endList()
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
+			if i == v.Len() {
+				return d.typeError(fmt.Sprintf("list of more than %d elements", v.Len()), v.Type(), pos)
+			}
+			err = d.with(fmt.Sprintf("[%d]", i), func() error { return d.read(v.Index(i)) })
+			if err != nil {
+				return err
+			}
+		}
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
 		}
 
 	case reflect.Slice: // (item ...)
-		for !endList(lex) {
+		if !v.IsNil() {
+			v.SetLen(0)
+		}
+		for {
+			end, err := d.endList()
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
 			item := reflect.New(v.Type().Elem()).Elem()
-			read(lex, item)
+			err = d.with(fmt.Sprintf("[%d]", v.Len()), func() error { return d.read(item) })
+			if err != nil {
+				return err
+			}
 			v.Set(reflect.Append(v, item))
 		}
 
 	case reflect.Struct: // ((name value) ...)
-		for !endList(lex) {
-			lex.consume('(')
-			if lex.token != scanner.Ident {
-				panic(fmt.Sprintf("got token %q, want field name", lex.text()))
+		for {
+			end, err := d.endList()
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
+			if err := d.consume('('); err != nil {
+				return err
+			}
+			if !isSymbolToken(lex.token) {
+				return d.syntaxError("got %s, want field name", lex.describe())
+			}
+			namePos := lex.pos
+			name := string(d.readSymbol())
+			var fv reflect.Value
+			if f, ok := lookupField(v.Type(), name, d.foldNames); ok {
+				fv = settableFieldByIndex(v, f.index)
+				name = f.name
+			}
+			if !fv.IsValid() {
+				if !d.ignoreUnknown {
+					return &UnknownFieldError{name, v.Type(),
+						strings.TrimPrefix(strings.Join(d.path, ""), "."), namePos.Line, namePos.Column}
+				}
+				if err := d.skip(nil); err != nil {
+					return err
+				}
+			} else {
+				err := d.with("."+name, func() error { return d.read(fv) })
+				if err != nil {
+					return err
+				}
+			}
+			if err := d.consume(')'); err != nil {
+				return err
 			}
-			name := lex.text()
-			lex.next()
-			read(lex, v.FieldByName(name))
-			lex.consume(')')
 		}
 
 	case reflect.Map: // ((key value) ...)
-		v.Set(reflect.MakeMap(v.Type()))
-		for !endList(lex) {
-			lex.consume('(')
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for {
+			end, err := d.endList()
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
+			if err := d.consume('('); err != nil {
+				return err
+			}
 			key := reflect.New(v.Type().Key()).Elem()
-			read(lex, key)
+			if err := d.with("(key)", func() error { return d.read(key) }); err != nil {
+				return err
+			}
 			value := reflect.New(v.Type().Elem()).Elem()
-			read(lex, value)
+			elem := fmt.Sprintf("[%v]", key)
+			if key.Kind() == reflect.String {
+				elem = fmt.Sprintf("[%q]", key)
+			}
+			if err := d.with(elem, func() error { return d.read(value) }); err != nil {
+				return err
+			}
 			v.SetMapIndex(key, value)
-			lex.consume(')')
+			if err := d.consume(')'); err != nil {
+				return err
+			}
 		}
 
 	default:
-		panic(fmt.Sprintf("cannot decode list into %v", v.Type()))
+		return d.typeError("list", v.Type(), pos)
 	}
+	return nil
 }
 
-func endList(lex *lexer) bool {
-	switch lex.token {
+// endList reports whether the current token ends a list.
+func (d *decodeState) endList() (bool, error) {
+	switch d.lex.token {
 	case scanner.EOF:
-		panic("end of file")
+		return false, d.syntaxError("unexpected end of input")
 	case ')':
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 
 //!-readlist
+
+// skip consumes one S-expression without decoding it.
+// If buf is non-nil, skip writes the expression to it,
+// with comments removed and each run of spaces between
+// tokens replaced by a single space.
+func (d *decodeState) skip(buf *bytes.Buffer) error {
+	lex := d.lex
+	depth := 0
+	end := -1  // offset of the end of the previous token
+	sharp := 0 // progress through #C, #n= or #n#: 1 after #, 2 after #n
+	for {
+		if lex.err != "" {
+			return d.syntaxError("%s", lex.err)
+		}
+		tok := lex.token
+		prefix := false // whether the token prefixes a value
+		switch {
+		case tok == scanner.EOF:
+			return d.syntaxError("unexpected end of input")
+		case sharp == 1:
+			prefix = true
+			sharp = 0
+			if tok == scanner.Int {
+				sharp = 2
+			}
+		case sharp == 2:
+			prefix = tok == '='
+			sharp = 0
+		case tok == '#':
+			prefix = true
+			sharp = 1
+		case tok == '-' || tok == '+' || tok == '\'':
+			prefix = true
+		case tok == '(':
+			depth++
+		case tok == ')':
+			if depth == 0 {
+				return d.syntaxError("unexpected %s", lex.describe())
+			}
+			depth--
+		}
+		d.skipToken(buf, &end)
+		if depth == 0 && !prefix {
+			// An atom continues through adjacent symbol tokens.
+			for isSymbolToken(tok) && isSymbolToken(lex.token) && lex.pos.Offset == end {
+				d.skipToken(buf, &end)
+			}
+			return nil
+		}
+	}
+}
+
+// skipToken writes the current token to buf, if non-nil, preceded by
+// a space unless it begins at offset *end, and then consumes it.
+func (d *decodeState) skipToken(buf *bytes.Buffer, end *int) {
+	text := d.lex.text()
+	if buf != nil {
+		if *end >= 0 && d.lex.pos.Offset != *end {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(text)
+	}
+	*end = d.lex.pos.Offset + len(text)
+	d.lex.next()
+}
@@ -9,23 +9,58 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+
+	"gopl.io/ch12/format"
 )
 
 //!+Marshal
 // Marshal encodes a Go value in S-expression form.
+// It returns an error if the value contains a cycle;
+// see MarshalOptions for a way to encode cyclic values.
 func Marshal(v interface{}) ([]byte, error) {
+	return MarshalOptions{}.Marshal(v)
+}
+
+//!-Marshal
+
+// MarshalOptions configures the encoding of Marshal.
+type MarshalOptions struct {
+	// Labels causes pointers that are reached more than once to be
+	// encoded once, with a label #n=, and then as references #n#,
+	// so that shared and cyclic structures can be encoded.
+	Labels bool
+}
+
+// Marshal encodes v in S-expression form.
+func (opts MarshalOptions) Marshal(v interface{}) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
+	rv := reflect.ValueOf(v)
+	if err := newEncoder(rv, opts.Labels).encode(&buf, rv); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-//!-Marshal
-
 // encode writes to buf an S-expression representation of v.
 //!+encode
-func encode(buf *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encode(buf *bytes.Buffer, v reflect.Value) error {
+	if data, ok, err := marshalCustom(v); ok {
+		buf.Write(data)
+		return err
+	}
+	var label string
+	if isRef(v) {
+		var done bool
+		var err error
+		label, done, err = enc.visit(v)
+		buf.WriteString(label)
+		if done || err != nil {
+			return err
+		}
+		defer enc.leave(v)
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		buf.WriteString("nil")
@@ -41,8 +76,35 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 	case reflect.String:
 		fmt.Fprintf(buf, "%q", v.String())
 
+	case reflect.Bool:
+		buf.WriteString(formatBool(v.Bool()))
+
+	case reflect.Float32, reflect.Float64:
+		buf.WriteString(formatFloat(v.Float(), v.Type().Bits()))
+
+	case reflect.Complex64, reflect.Complex128:
+		buf.WriteString(formatComplex(v.Complex(), v.Type().Bits()))
+
 	case reflect.Ptr:
-		return encode(buf, v.Elem())
+		if label == "" && enc.quoted(v.Elem()) {
+			buf.WriteByte('\'')
+		}
+		return enc.encode(buf, v.Elem())
+
+	case reflect.Interface: // ("type" value)
+		if v.IsNil() {
+			buf.WriteString("nil")
+			break
+		}
+		name, err := interfaceTypeName(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "(%q ", name)
+		if err := enc.encode(buf, v.Elem()); err != nil {
+			return err
+		}
+		buf.WriteByte(')')
 
 	case reflect.Array, reflect.Slice: // (value ...)
 		buf.WriteByte('(')
@@ -50,7 +112,7 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
-			if err := encode(buf, v.Index(i)); err != nil {
+			if err := enc.encode(buf, v.Index(i)); err != nil {
 				return err
 			}
 		}
@@ -58,12 +120,18 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 
 	case reflect.Struct: // ((name value) ...)
 		buf.WriteByte('(')
-		for i := 0; i < v.NumField(); i++ {
-			if i > 0 {
+		sep := false
+		for _, f := range structFields(v.Type()) {
+			fv := fieldByIndex(v, f.index)
+			if !fv.IsValid() || f.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			if sep {
 				buf.WriteByte(' ')
 			}
-			fmt.Fprintf(buf, "(%s ", v.Type().Field(i).Name)
-			if err := encode(buf, v.Field(i)); err != nil {
+			sep = true
+			fmt.Fprintf(buf, "(%s ", f.name)
+			if err := enc.encode(buf, fv); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
@@ -72,26 +140,95 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 
 	case reflect.Map: // ((key value) ...)
 		buf.WriteByte('(')
-		for i, key := range v.MapKeys() {
+		for i, e := range format.SortedMap(v) {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
 			buf.WriteByte('(')
-			if err := encode(buf, key); err != nil {
+			if err := enc.encode(buf, e.Key); err != nil {
 				return err
 			}
 			buf.WriteByte(' ')
-			if err := encode(buf, v.MapIndex(key)); err != nil {
+			if err := enc.encode(buf, e.Value); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
 		}
 		buf.WriteByte(')')
 
-	default: // float, complex, bool, chan, func, interface
+	default: // chan, func, unsafe.Pointer
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
 }
 
 //!-encode
+
+// formatBool returns the Lisp truth value for b: t or nil.
+func formatBool(b bool) string {
+	if b {
+		return "t"
+	}
+	return "nil"
+}
+
+// quoted reports whether a non-nil pointer to v, without a label,
+// must be written with a quote, as in 'nil, because v is encoded as
+// nil, or is a pointer whose encoding begins with a label or a quote.
+// Otherwise the decoder would read a nil pointer, or would take
+// the label to be that of the outer pointer.
+func (enc *encoder) quoted(v reflect.Value) bool {
+	if _, ok := marshalerValue(v); ok {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Interface:
+		return v.IsNil()
+	case reflect.Ptr:
+		if v.IsNil() {
+			return true
+		}
+		r := refOf(v)
+		if _, ok := enc.labels[r]; ok {
+			return true
+		}
+		if enc.active[r] {
+			return false // a cycle, which encode reports
+		}
+		return enc.quoted(v.Elem())
+	}
+	return false
+}
+
+// formatFloat returns the shortest decimal form of f that reads
+// back exactly as a float of the given size, or NaN, +Inf or -Inf.
+// The form always has a decimal point or an exponent, as in 3.0
+// or 1e+21, so that it is not read as an integer.
+func formatFloat(f float64, bits int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// formatComplex returns c in Common Lisp form, #C(re im).
+func formatComplex(c complex128, bits int) string {
+	// The parts are always read as floats, so need no decimal point.
+	re := strconv.FormatFloat(real(c), 'g', -1, bits/2)
+	im := strconv.FormatFloat(imag(c), 'g', -1, bits/2)
+	return fmt.Sprintf("#C(%s %s)", re, im)
+}
+
+// interfaceTypeName returns the registered name of
+// the dynamic type of the non-nil interface v.
+func interfaceTypeName(v reflect.Value) (string, error) {
+	t := v.Elem().Type()
+	name, ok := typeName(t)
+	if !ok {
+		return "", fmt.Errorf("type not registered for interface: %s", t)
+	}
+	return name, nil
+}
@@ -0,0 +1,248 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A struct field is encoded as (name value). As in encoding/json,
+// the name may be changed by a field tag, and the tag options may
+// omit the field when it has an empty value:
+//
+//	Title string `sexpr:"title"`           // encoded as (title ...)
+//	Year  int    `sexpr:"year,omitempty"`  // omitted if zero
+//	Notes string `sexpr:",omitempty"`      // (Notes ...) unless empty
+//	Cache []byte `sexpr:"-"`               // never encoded or decoded
+//	First string `sexpr:"first-name"`      // encoded as (first-name ...)
+//	Dash  string `sexpr:"-,"`              // encoded as (- ...)
+//
+// A tag name may be any symbol; one that is not, such as a name
+// containing a space or a parenthesis, is ignored.
+// Unexported fields are ignored. The exported fields of an
+// untagged embedded struct are promoted into the outer struct,
+// subject to the Go rules for ambiguous names, with tagged names
+// breaking ties at the same depth.
+
+// A field describes how a struct field is encoded.
+type field struct {
+	name      string
+	index     []int // as for reflect.Value.FieldByIndex
+	omitEmpty bool
+	tagged    bool // name came from a tag
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the encoded fields of struct type t,
+// in the order of their declaration.
+func structFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+	fields, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return fields.([]field)
+}
+
+func typeFields(t reflect.Type) []field {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var fields []field
+	visited := map[reflect.Type]bool{}
+	// Examine the struct and its embedded structs breadth first.
+	var current []embedded
+	next := []embedded{{typ: t}}
+	for len(next) > 0 {
+		current, next = next, nil
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				typ := sf.Type
+				if typ.Kind() == reflect.Ptr {
+					typ = typ.Elem()
+				}
+				if sf.PkgPath != "" && !(sf.Anonymous && typ.Kind() == reflect.Struct) {
+					continue // unexported
+				}
+				tag := sf.Tag.Get("sexpr")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+				if !isSymbol(name) {
+					name = ""
+				}
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				if name == "" && sf.Anonymous && typ.Kind() == reflect.Struct {
+					// Promote the fields of an untagged embedded struct.
+					next = append(next, embedded{typ, index})
+					continue
+				}
+				if sf.PkgPath != "" {
+					continue // unexported embedded struct with a tag
+				}
+				fields = append(fields, field{
+					name:      firstNonEmpty(name, sf.Name),
+					index:     index,
+					omitEmpty: hasOption(opts, "omitempty"),
+					tagged:    name != "",
+				})
+			}
+		}
+		// Mark the types only after the whole level, so that
+		// a struct embedded twice at one depth is ambiguous.
+		for _, e := range current {
+			visited[e.typ] = true
+		}
+	}
+
+	// Discard fields hidden by a shallower field of the same name,
+	// and ambiguous fields at the same depth.
+	sort.SliceStable(fields, func(i, j int) bool {
+		x, y := fields[i], fields[j]
+		if x.name != y.name {
+			return x.name < y.name
+		}
+		if len(x.index) != len(y.index) {
+			return len(x.index) < len(y.index)
+		}
+		return x.tagged && !y.tagged
+	})
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		dominant := fields[i]
+		if j-i == 1 || len(fields[i+1].index) > len(dominant.index) ||
+			dominant.tagged && !fields[i+1].tagged {
+			out = append(out, dominant)
+		}
+		i = j
+	}
+
+	// Restore declaration order.
+	sort.Slice(out, func(i, j int) bool {
+		x, y := out[i].index, out[j].index
+		for k := 0; k < len(x) && k < len(y); k++ {
+			if x[k] != y[k] {
+				return x[k] < y[k]
+			}
+		}
+		return len(x) < len(y)
+	})
+	return out
+}
+
+// parseTag splits a struct field tag into its name and options.
+func parseTag(tag string) (name, opts string) {
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+// hasOption reports whether the comma-separated opts include opt.
+func hasOption(opts, opt string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func firstNonEmpty(s, t string) string {
+	if s != "" {
+		return s
+	}
+	return t
+}
+
+// lookupField returns the field of struct type t with the given name.
+// If fold is set and no name matches exactly, it returns the first
+// field whose name matches under Unicode case folding.
+func lookupField(t reflect.Type, name string, fold bool) (field, bool) {
+	fields := structFields(t)
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	if fold {
+		for _, f := range fields {
+			if strings.EqualFold(f.name, name) {
+				return f, true
+			}
+		}
+	}
+	return field{}, false
+}
+
+// fieldByIndex returns the field of the struct v with the given index,
+// or an invalid Value if the path passes through a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// settableFieldByIndex is like fieldByIndex, but allocates
+// nil embedded pointers along the path.
+func settableFieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{} // unexported embedded pointer
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// isEmptyValue reports whether v is empty for the purposes
+// of the omitempty option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
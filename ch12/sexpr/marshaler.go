@@ -0,0 +1,139 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"text/scanner"
+)
+
+// Marshaler is the interface implemented by types that
+// can encode themselves as an S-expression.
+// The result must be exactly one well-formed S-expression.
+type Marshaler interface {
+	MarshalSExpr() ([]byte, error)
+}
+
+// Unmarshaler is the interface implemented by types that can
+// decode an S-expression representation of themselves.
+// UnmarshalSExpr is called with a single S-expression,
+// which it must copy if it wishes to retain it.
+type Unmarshaler interface {
+	UnmarshalSExpr([]byte) error
+}
+
+// Types that implement neither interface but do implement
+// encoding.TextMarshaler or encoding.TextUnmarshaler
+// are encoded as the S-expression string of their text.
+
+var (
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// marshalerValue returns v, or its address if v is addressable,
+// whichever implements Marshaler or encoding.TextMarshaler.
+// Nil pointers and interfaces are encoded as usual.
+func marshalerValue(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() || v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr && v.IsNil() {
+		return reflect.Value{}, false // encoded as nil or ("type" value)
+	}
+	for _, x := range []reflect.Value{v, addr(v)} {
+		if x.IsValid() && x.CanInterface() &&
+			(x.Type().Implements(marshalerType) || x.Type().Implements(textMarshalerType)) {
+			return x, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// marshalCustom encodes v using its MarshalSExpr or MarshalText method,
+// if it has one. A method with a pointer receiver is used only if v
+// is addressable. It reports whether v had such a method.
+func marshalCustom(v reflect.Value) (data []byte, ok bool, err error) {
+	x, ok := marshalerValue(v)
+	if !ok {
+		return nil, false, nil
+	}
+	if m, ok := x.Interface().(Marshaler); ok {
+		data, err := m.MarshalSExpr()
+		if err != nil {
+			return nil, true, fmt.Errorf("sexpr: error calling MarshalSExpr for type %s: %w", x.Type(), err)
+		}
+		if err := checkValid(data); err != nil {
+			return nil, true, fmt.Errorf("sexpr: invalid output from MarshalSExpr for type %s: %w", x.Type(), err)
+		}
+		return data, true, nil
+	}
+	text, err := x.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return nil, true, fmt.Errorf("sexpr: error calling MarshalText for type %s: %w", x.Type(), err)
+	}
+	return []byte(strconv.Quote(string(text))), true, nil
+}
+
+// addr returns the address of v, or an invalid Value
+// if v is not addressable.
+func addr(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Ptr || !v.CanAddr() {
+		return reflect.Value{}
+	}
+	return v.Addr()
+}
+
+// checkValid returns an error unless data holds
+// exactly one S-expression.
+func checkValid(data []byte) error {
+	d := &decodeState{lex: newLexer(bytes.NewReader(data))}
+	d.lex.next()
+	if err := d.skip(nil); err != nil {
+		return err
+	}
+	if d.lex.token != scanner.EOF {
+		return d.syntaxError("unexpected %s after top-level value", d.lex.describe())
+	}
+	return nil
+}
+
+// unmarshalCustom decodes the next S-expression into the addressable
+// variable v using its UnmarshalSExpr or UnmarshalText method,
+// if it has one. It reports whether v had such a method.
+func (d *decodeState) unmarshalCustom(v reflect.Value) (ok bool, err error) {
+	pv := addr(v)
+	if !pv.IsValid() || !pv.CanInterface() {
+		return false, nil
+	}
+	switch {
+	case pv.Type().Implements(unmarshalerType):
+		var buf bytes.Buffer
+		if err := d.skip(&buf); err != nil {
+			return true, err
+		}
+		return true, pv.Interface().(Unmarshaler).UnmarshalSExpr(buf.Bytes())
+	case pv.Type().Implements(textUnmarshalerType):
+		pos := d.lex.pos
+		if d.lex.token == scanner.Ident && d.lex.text() == "nil" {
+			return false, nil // zero value
+		}
+		if d.lex.token != scanner.String && d.lex.token != scanner.RawString {
+			return true, d.typeError("non-string value", v.Type(), pos)
+		}
+		s, err := strconv.Unquote(d.lex.text())
+		if err != nil {
+			return true, d.syntaxError("invalid string %s", d.lex.text())
+		}
+		d.lex.next()
+		if err := pv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return true, d.typeError(fmt.Sprintf("string %q (%v)", s, err), v.Type(), pos)
+		}
+		return true, nil
+	}
+	return false, nil
+}
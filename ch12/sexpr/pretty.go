@@ -10,11 +10,39 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+
+	"gopl.io/ch12/format"
 )
 
+// MarshalIndent is like Marshal but lays out the output
+// within 80 columns, in the manner of MarshalIndentOptions.
 func MarshalIndent(v interface{}) ([]byte, error) {
-	p := printer{width: margin}
-	if err := pretty(&p, reflect.ValueOf(v)); err != nil {
+	return MarshalIndentOptions{}.Marshal(v)
+}
+
+// MarshalIndentOptions configures the layout of MarshalIndent output.
+// The zero value gives the layout of MarshalIndent.
+type MarshalIndentOptions struct {
+	// Width is the maximum line width; zero means 80.
+	// A line is longer only if it holds an atom that does not fit.
+	Width int
+
+	// Indent is the number of columns by which the elements of
+	// a list that does not fit on one line are indented relative
+	// to its opening parenthesis; zero means 1, which aligns them
+	// with the first element.
+	Indent int
+
+	// Labels has the same meaning as in MarshalOptions.
+	Labels bool
+}
+
+// Marshal encodes v in S-expression form, breaking each list
+// that does not fit within the width across several lines.
+func (opts MarshalIndentOptions) Marshal(v interface{}) ([]byte, error) {
+	p := NewPrinter(PrinterOptions{Width: opts.Width, Indent: opts.Indent})
+	rv := reflect.ValueOf(v)
+	if err := newEncoder(rv, opts.Labels).pretty(p, rv); err != nil {
 		return nil, err
 	}
 	return p.Bytes(), nil
@@ -28,17 +56,60 @@ type token struct {
 	size int
 }
 
-type printer struct {
+// A Printer is a layout engine for nested groups of text.
+// It is the printer used by MarshalIndent, and may be used
+// to lay out other nested structures, such as expressions:
+// the client describes the text as a sequence of calls to
+// Text, Space, Begin and End, and the Printer turns as few
+// spaces as possible into line breaks to fit within the width.
+//
+// Each Space within a group, that is, between a call to Begin
+// and its matching End, breaks only if the text up to the next
+// Space or End of that group does not fit on the line.
+// A broken line continues at the column where the group began,
+// plus the indent. The output is complete after the outermost
+// group ends.
+type Printer struct {
 	tokens []*token // FIFO buffer
 	stack  []*token // stack of open ' ' and '(' tokens
 	rtotal int      // total number of spaces needed to print stream
 
-	bytes.Buffer
+	buf     bytes.Buffer
 	indents []int
 	width   int // remaining space
+	margin  int
+	indent  int
 }
 
-func (p *printer) string(str string) {
+// PrinterOptions configures the layout of a Printer.
+// The zero value gives the layout of MarshalIndent.
+type PrinterOptions struct {
+	// Width is the maximum line width; zero means 80.
+	Width int
+
+	// Indent is the number of columns by which a broken line is
+	// indented relative to the start of its group; zero means 1.
+	Indent int
+}
+
+// NewPrinter returns a Printer with the width and indent specified by opts.
+func NewPrinter(opts PrinterOptions) *Printer {
+	p := &Printer{margin: opts.Width, indent: opts.Indent}
+	if p.margin <= 0 {
+		p.margin = margin
+	}
+	if p.indent <= 0 {
+		p.indent = 1
+	}
+	p.width = p.margin
+	return p
+}
+
+// Bytes returns the text printed so far.
+func (p *Printer) Bytes() []byte { return p.buf.Bytes() }
+
+// Text adds the string str, which should not contain newlines.
+func (p *Printer) Text(str string) {
 	tok := &token{kind: 's', str: str, size: len(str)}
 	if len(p.stack) == 0 {
 		p.print(tok)
@@ -47,22 +118,28 @@ func (p *printer) string(str string) {
 		p.rtotal += len(str)
 	}
 }
-func (p *printer) pop() (top *token) {
+func (p *Printer) pop() (top *token) {
 	last := len(p.stack) - 1
 	top, p.stack = p.stack[last], p.stack[:last]
 	return
 }
-func (p *printer) begin() {
+
+// Begin starts a group.
+func (p *Printer) Begin() {
 	if len(p.stack) == 0 {
 		p.rtotal = 1
 	}
 	t := &token{kind: '(', size: -p.rtotal}
 	p.tokens = append(p.tokens, t)
 	p.stack = append(p.stack, t) // push
-	p.string("(")
 }
-func (p *printer) end() {
-	p.string(")")
+
+// End ends the group started by the matching call to Begin.
+// An End without a matching Begin is ignored.
+func (p *Printer) End() {
+	if len(p.stack) == 0 {
+		return
+	}
 	p.tokens = append(p.tokens, &token{kind: ')'})
 	x := p.pop()
 	x.size += p.rtotal
@@ -76,7 +153,14 @@ func (p *printer) end() {
 		p.tokens = nil
 	}
 }
-func (p *printer) space() {
+
+// Space adds a space that may be replaced by a line break.
+// Outside any group, it adds a space that is never replaced.
+func (p *Printer) Space() {
+	if len(p.stack) == 0 {
+		p.Text(" ")
+		return
+	}
 	last := len(p.stack) - 1
 	x := p.stack[last]
 	if x.kind == ' ' {
@@ -88,10 +172,10 @@ func (p *printer) space() {
 	p.stack = append(p.stack, t)
 	p.rtotal++
 }
-func (p *printer) print(t *token) {
+func (p *Printer) print(t *token) {
 	switch t.kind {
 	case 's':
-		p.WriteString(t.str)
+		p.buf.WriteString(t.str)
 		p.width -= len(t.str)
 	case '(':
 		p.indents = append(p.indents, p.width)
@@ -99,19 +183,48 @@ func (p *printer) print(t *token) {
 		p.indents = p.indents[:len(p.indents)-1] // pop
 	case ' ':
 		if t.size > p.width {
-			p.width = p.indents[len(p.indents)-1] - 1
-			fmt.Fprintf(&p.Buffer, "\n%*s", margin-p.width, "")
+			p.width = p.indents[len(p.indents)-1] - p.indent
+			fmt.Fprintf(&p.buf, "\n%*s", p.margin-p.width, "")
 		} else {
-			p.WriteByte(' ')
+			p.buf.WriteByte(' ')
 			p.width--
 		}
 	}
 }
-func (p *printer) stringf(format string, args ...interface{}) {
-	p.string(fmt.Sprintf(format, args...))
+
+// The S-expression encoding uses these abbreviations.
+func (p *Printer) string(str string) { p.Text(str) }
+func (p *Printer) stringf(format string, args ...interface{}) {
+	p.Text(fmt.Sprintf(format, args...))
+}
+func (p *Printer) begin() {
+	p.Begin()
+	p.Text("(")
 }
+func (p *Printer) end() {
+	p.Text(")")
+	p.End()
+}
+func (p *Printer) space() { p.Space() }
 
-func pretty(p *printer, v reflect.Value) error {
+func (enc *encoder) pretty(p *Printer, v reflect.Value) error {
+	if data, ok, err := marshalCustom(v); ok {
+		p.string(string(data))
+		return err
+	}
+	var label string
+	if isRef(v) {
+		var done bool
+		var err error
+		label, done, err = enc.visit(v)
+		if label != "" {
+			p.string(label)
+		}
+		if done || err != nil {
+			return err
+		}
+		defer enc.leave(v)
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		p.string("nil")
@@ -127,13 +240,22 @@ func pretty(p *printer, v reflect.Value) error {
 	case reflect.String:
 		p.stringf("%q", v.String())
 
+	case reflect.Bool:
+		p.string(formatBool(v.Bool()))
+
+	case reflect.Float32, reflect.Float64:
+		p.string(formatFloat(v.Float(), v.Type().Bits()))
+
+	case reflect.Complex64, reflect.Complex128:
+		p.string(formatComplex(v.Complex(), v.Type().Bits()))
+
 	case reflect.Array, reflect.Slice: // (value ...)
 		p.begin()
 		for i := 0; i < v.Len(); i++ {
 			if i > 0 {
 				p.space()
 			}
-			if err := pretty(p, v.Index(i)); err != nil {
+			if err := enc.pretty(p, v.Index(i)); err != nil {
 				return err
 			}
 		}
@@ -141,14 +263,20 @@ func pretty(p *printer, v reflect.Value) error {
 
 	case reflect.Struct: // ((name value ...)
 		p.begin()
-		for i := 0; i < v.NumField(); i++ {
-			if i > 0 {
+		sep := false
+		for _, f := range structFields(v.Type()) {
+			fv := fieldByIndex(v, f.index)
+			if !fv.IsValid() || f.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			if sep {
 				p.space()
 			}
+			sep = true
 			p.begin()
-			p.string(v.Type().Field(i).Name)
+			p.string(f.name)
 			p.space()
-			if err := pretty(p, v.Field(i)); err != nil {
+			if err := enc.pretty(p, fv); err != nil {
 				return err
 			}
 			p.end()
@@ -157,16 +285,16 @@ func pretty(p *printer, v reflect.Value) error {
 
 	case reflect.Map: // ((key value ...)
 		p.begin()
-		for i, key := range v.MapKeys() {
+		for i, e := range format.SortedMap(v) {
 			if i > 0 {
 				p.space()
 			}
 			p.begin()
-			if err := pretty(p, key); err != nil {
+			if err := enc.pretty(p, e.Key); err != nil {
 				return err
 			}
 			p.space()
-			if err := pretty(p, v.MapIndex(key)); err != nil {
+			if err := enc.pretty(p, e.Value); err != nil {
 				return err
 			}
 			p.end()
@@ -174,9 +302,29 @@ func pretty(p *printer, v reflect.Value) error {
 		p.end()
 
 	case reflect.Ptr:
-		return pretty(p, v.Elem())
+		if label == "" && enc.quoted(v.Elem()) {
+			p.string("'")
+		}
+		return enc.pretty(p, v.Elem())
+
+	case reflect.Interface: // ("type" value)
+		if v.IsNil() {
+			p.string("nil")
+			break
+		}
+		name, err := interfaceTypeName(v)
+		if err != nil {
+			return err
+		}
+		p.begin()
+		p.stringf("%q", name)
+		p.space()
+		if err := enc.pretty(p, v.Elem()); err != nil {
+			return err
+		}
+		p.end()
 
-	default: // float, complex, bool, chan, func, interface
+	default: // chan, func, unsafe.Pointer
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
@@ -0,0 +1,76 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// An interface value is encoded as ("name" value), where name
+// identifies the dynamic type. Decoding can rebuild the value
+// only if its type has been registered.
+var registry struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}
+
+// Register records the type of value, under the name printed
+// by %T, so that interface values holding that type may be
+// encoded and decoded. The basic types are registered already.
+func Register(value interface{}) {
+	RegisterName(reflect.TypeOf(value).String(), value)
+}
+
+// RegisterName is like Register but uses the given name for the type.
+// It panics if either the name or the type is already registered
+// with a different counterpart.
+func RegisterName(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		panic("sexpr: RegisterName of nil value")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if prev, ok := registry.types[name]; ok && prev != t {
+		panic(fmt.Sprintf("sexpr: registering duplicate types for %q: %s != %s", name, prev, t))
+	}
+	if prev, ok := registry.names[t]; ok && prev != name {
+		panic(fmt.Sprintf("sexpr: registering duplicate names for %s: %q != %q", t, prev, name))
+	}
+	registry.types[name] = t
+	registry.names[t] = name
+}
+
+// typeName returns the registered name of t.
+func typeName(t reflect.Type) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	name, ok := registry.names[t]
+	return name, ok
+}
+
+// typeByName returns the registered type of the given name.
+func typeByName(name string) (reflect.Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+func init() {
+	registry.types = make(map[string]reflect.Type)
+	registry.names = make(map[reflect.Type]string)
+	for _, v := range []interface{}{
+		false, "",
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+		[]interface{}(nil), map[string]interface{}(nil),
+	} {
+		Register(v)
+	}
+}
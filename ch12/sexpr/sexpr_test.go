@@ -4,17 +4,22 @@
 package sexpr
 
 import (
+	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Test verifies that encoding and decoding a complex data value
-// produces an equal result.
+// produces an equal result, and that the encoded output is exactly
+// as expected. Map keys are encoded in sorted order, so the output
+// is deterministic.
 //
-// The test does not make direct assertions about the encoded output
-// because the output depends on map iteration order, which is
-// nondeterministic.  The output of the t.Log statements can be
-// inspected by running the test with the -v flag:
+// The output of the t.Log statements can be inspected by running
+// the test with the -v flag:
 //
 // 	$ go test -v gopl.io/ch12/sexpr
 //
@@ -52,6 +57,9 @@ func Test(t *testing.T) {
 		t.Fatalf("Marshal failed: %v", err)
 	}
 	t.Logf("Marshal() = %s\n", data)
+	if string(data) != wantMarshal {
+		t.Errorf("Marshal() = %s, want %s", data, wantMarshal)
+	}
 
 	// Decode it
 	var movie Movie
@@ -71,4 +79,919 @@ func Test(t *testing.T) {
 		t.Fatal(err)
 	}
 	t.Logf("MarshalIdent() = %s\n", data)
+	if string(data) != wantIndent {
+		t.Errorf("MarshalIndent() = %s, want %s", data, wantIndent)
+	}
+}
+
+const wantMarshal = `((Title "Dr. Strangelove") (Subtitle "How I Learned to Stop Worrying and Love the Bomb") (Year 1964) (Actor (("Brig. Gen. Jack D. Ripper" "Sterling Hayden") ("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott") ("Grp. Capt. Lionel Mandrake" "Peter Sellers") ("Maj. T.J. \"King\" Kong" "Slim Pickens") ("Pres. Merkin Muffley" "Peter Sellers"))) (Oscars ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)" "Best Director (Nomin.)" "Best Picture (Nomin.)")) (Sequel nil))`
+
+const wantIndent = `((Title "Dr. Strangelove")
+ (Subtitle "How I Learned to Stop Worrying and Love the Bomb") (Year 1964)
+ (Actor
+  (("Brig. Gen. Jack D. Ripper" "Sterling Hayden")
+   ("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott")
+   ("Grp. Capt. Lionel Mandrake" "Peter Sellers")
+   ("Maj. T.J. \"King\" Kong" "Slim Pickens")
+   ("Pres. Merkin Muffley" "Peter Sellers")))
+ (Oscars
+  ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)"
+   "Best Director (Nomin.)" "Best Picture (Nomin.)")) (Sequel nil))`
+
+type shape interface{ area() float64 }
+
+type circle struct{ R float64 }
+type square struct{ Side float64 }
+
+func (c circle) area() float64  { return math.Pi * c.R * c.R }
+func (s *square) area() float64 { return s.Side * s.Side }
+
+func init() {
+	Register(circle{})
+	Register(&square{})
+}
+
+// TestRoundTrip checks that values of every supported kind
+// survive Marshal and Unmarshal, and MarshalIndent and Unmarshal.
+func TestRoundTrip(t *testing.T) {
+	type Scalars struct {
+		B, F          bool
+		I             int
+		I8            int8
+		U             uint
+		U16           uint16
+		F32           float32
+		F64           float64
+		C64           complex64
+		C128          complex128
+		Neg           int
+		NegF, Tiny    float64
+		Huge, NegHuge float64
+		S             string
+	}
+	type Shapes struct {
+		Shapes []shape
+		Any    []interface{}
+		Named  map[string]interface{}
+		None   interface{}
+	}
+	type Pointers struct {
+		False, True, Nil *bool
+		Zero             *int
+		Empty            *string
+		ToNil            **int
+		ToFalse          **bool
+		Any              *interface{}
+		Shared, Alias    *bool
+		ToShared         **bool
+	}
+	f, zero, empty, nilInt, none := false, 0, "", (*int)(nil), interface{}(nil)
+	tru, shared := true, false
+	toFalse, toShared := &f, &shared
+	for _, test := range []struct {
+		value interface{} // pointer to the value
+		zero  interface{} // pointer to a zero value of the same type
+	}{
+		{&Scalars{
+			B: true, I: 42, I8: -8, U: 7, U16: 65535,
+			F32: 0.1, F64: 1.0 / 3, C64: complex(1.5, -2), C128: complex(-0.25, 1e300),
+			Neg: -12345, NegF: -2.5e-10, Tiny: 5e-324,
+			Huge: math.Inf(1), NegHuge: math.Inf(-1), S: "t",
+		}, new(Scalars)},
+		{&Shapes{
+			Shapes: []shape{circle{1}, &square{2}, nil},
+			Any:    []interface{}{1, "two", 3.0, true, []interface{}{uint8(4)}},
+			Named:  map[string]interface{}{"complex": 1i, "nil": nil},
+		}, new(Shapes)},
+		{&[]float64{0, -0.5, 1e21, 123456789}, new([]float64)},
+		{&[]bool{true, false}, new([]bool)},
+		{&Pointers{
+			False: &f, True: &tru, Zero: &zero, Empty: &empty,
+			ToNil: &nilInt, ToFalse: &toFalse, Any: &none,
+			Shared: &shared, Alias: &shared, ToShared: &toShared,
+		}, new(Pointers)},
+	} {
+		for _, marshal := range []func(interface{}) ([]byte, error){
+			Marshal, MarshalIndent, MarshalOptions{Labels: true}.Marshal,
+		} {
+			data, err := marshal(test.value)
+			if err != nil {
+				t.Errorf("Marshal(%T): %v", test.value, err)
+				continue
+			}
+			got := reflect.New(reflect.TypeOf(test.zero).Elem()).Interface()
+			if err := Unmarshal(data, got); err != nil {
+				t.Errorf("Unmarshal(%s): %v", data, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, test.value) {
+				t.Errorf("round trip of %s:\ngot  %#v\nwant %#v", data, got, test.value)
+			}
+		}
+	}
+}
+
+func TestMarshalAtoms(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		want  string
+	}{
+		{true, "t"},
+		{false, "nil"},
+		{1.5, "1.5"},
+		{3.0, "3.0"},
+		{math.Copysign(0, -1), "-0.0"},
+		{1e21, "1e+21"},
+		{float32(0.1), "0.1"},
+		{math.NaN(), "NaN"},
+		{math.Inf(-1), "-Inf"},
+		{complex(1, -2), "#C(1 -2)"},
+		{[]interface{}{circle{2}}, `(("sexpr.circle" ((R 2.0))))`},
+		{[]interface{}{nil, -3}, `(nil ("int" -3))`},
+	} {
+		data, err := Marshal(test.value)
+		if err != nil {
+			t.Errorf("Marshal(%v): %v", test.value, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("Marshal(%v) = %s, want %s", test.value, data, test.want)
+		}
+	}
+
+	var f float64
+	if err := Unmarshal([]byte("NaN"), &f); err != nil || !math.IsNaN(f) {
+		t.Errorf("Unmarshal(NaN) = %g, %v", f, err)
+	}
+	data, err := Marshal(3.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x interface{}
+	if err := Unmarshal(data, &x); err != nil || x != Float(3) {
+		t.Errorf("Unmarshal(%s) = %#v, %v, want Float(3)", data, x, err)
+	}
+
+	type unregistered struct{}
+	if _, err := Marshal([]interface{}{unregistered{}}); err == nil {
+		t.Errorf("Marshal of unregistered type in interface succeeded")
+	}
+}
+
+func TestDecoderDecode(t *testing.T) {
+	type Entry struct {
+		Level string
+		Code  int
+	}
+	input := `((Level "info") (Code 1))
+	((Level "warn") (Code -2))   ((Level "error") (Code 3))`
+	dec := NewDecoder(strings.NewReader(input))
+	var got []Entry
+	for {
+		var e Entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	want := []Entry{{"info", 1}, {"warn", -2}, {"error", 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode: got %v, want %v", got, want)
+	}
+}
+
+func TestDecoderToken(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`(Title "Dr. Strangelove" -1964 2.5 -Inf #C(1 2)) nil`))
+	var got []Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+	}
+	want := []Token{
+		StartList{}, Symbol("Title"), String("Dr. Strangelove"), Int(-1964),
+		Float(2.5), Float(math.Inf(-1)), Symbol("#C"), StartList{}, Int(1), Int(2), EndList{},
+		EndList{}, Symbol("nil"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Token:\ngot  %#v\nwant %#v", got, want)
+	}
+}
+
+// TestDecoderMixed reads a long list element by element.
+func TestDecoderMixed(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`(("a" 1) ("b" 2) ("c" 3)) ("tail")`))
+	if tok, err := dec.Token(); err != nil || tok != (StartList{}) {
+		t.Fatalf("Token() = %v, %v, want StartList", tok, err)
+	}
+	var sum int
+	for dec.More() {
+		var pair struct {
+			Name string
+			N    int
+		}
+		if tok, err := dec.Token(); err != nil || tok != (StartList{}) {
+			t.Fatalf("Token() = %v, %v, want StartList", tok, err)
+		}
+		if err := dec.Decode(&pair.Name); err != nil {
+			t.Fatal(err)
+		}
+		if err := dec.Decode(&pair.N); err != nil {
+			t.Fatal(err)
+		}
+		if tok, err := dec.Token(); err != nil || tok != (EndList{}) {
+			t.Fatalf("Token() = %v, %v, want EndList", tok, err)
+		}
+		sum += pair.N
+	}
+	if tok, err := dec.Token(); err != nil || tok != (EndList{}) {
+		t.Fatalf("Token() = %v, %v, want EndList", tok, err)
+	}
+	if sum != 6 {
+		t.Errorf("sum = %d, want 6", sum)
+	}
+	var tail []string
+	if err := dec.Decode(&tail); err != nil || len(tail) != 1 || tail[0] != "tail" {
+		t.Errorf("Decode = %q, %v", tail, err)
+	}
+	if err := dec.Decode(&tail); err != io.EOF {
+		t.Errorf("Decode at end = %v, want io.EOF", err)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	for _, test := range []struct {
+		input        string
+		line, column int
+	}{
+		{`(1 2`, 1, 5},
+		{`(1 2))`, 1, 6},
+		{"(1\n  2\n  )\n)", 4, 1},
+		{`(1 - x)`, 1, 6},
+		{`(1 - 5)`, 1, 6},
+		{"(+\n5)", 2, 1},
+		{`"unterminated`, 1, 1},
+		{`#Q(1 2)`, 1, 2},
+		{`#X(1 2)`, 1, 1},
+		{`[1]`, 1, 1},
+	} {
+		var v []int
+		err := Unmarshal([]byte(test.input), &v)
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Unmarshal(%q) = %v, want *SyntaxError", test.input, err)
+			continue
+		}
+		if serr.Line != test.line || serr.Column != test.column {
+			t.Errorf("Unmarshal(%q): error %q at %d:%d, want %d:%d",
+				test.input, serr, serr.Line, serr.Column, test.line, test.column)
+		}
+	}
+
+	// A sign next to its digits is part of the number.
+	var v []int
+	if err := Unmarshal([]byte(`(-5 +5)`), &v); err != nil || !reflect.DeepEqual(v, []int{-5, 5}) {
+		t.Errorf("Unmarshal((-5 +5)) = %v, %v, want [-5 5]", v, err)
+	}
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	type Movie struct {
+		Title  string
+		Year   uint16
+		Actor  map[string]string
+		Oscars [2]string
+		Rating float32
+	}
+	for _, test := range []struct {
+		input, field string
+	}{
+		{`((Title 1964))`, "Title"},
+		{`((Year -1))`, "Year"},
+		{`((Year 70000))`, "Year"},
+		{`((Actor (("Dr. Strangelove" t))))`, `Actor["Dr. Strangelove"]`},
+		{`((Oscars ("a" "b" "c")))`, "Oscars"},
+		{`((Oscars ("a" 2)))`, "Oscars[1]"},
+		{`((Rating 1e100))`, "Rating"},
+		{`((Title ("x")))`, "Title"},
+	} {
+		var movie Movie
+		err := Unmarshal([]byte(test.input), &movie)
+		terr, ok := err.(*UnmarshalTypeError)
+		if !ok {
+			t.Errorf("Unmarshal(%q) = %v, want *UnmarshalTypeError", test.input, err)
+			continue
+		}
+		if terr.Field != test.field {
+			t.Errorf("Unmarshal(%q): error %q has field %q, want %q",
+				test.input, terr, terr.Field, test.field)
+		}
+	}
+
+	var a [3]int
+	a[2] = 9
+	if err := Unmarshal([]byte(`(1 2)`), &a); err != nil || a != [3]int{1, 2, 0} {
+		t.Errorf("Unmarshal short array = %v, %v", a, err)
+	}
+	if err := Unmarshal([]byte(`(1)`), new(int)); err == nil {
+		t.Errorf("Unmarshal list into int succeeded")
+	}
+	if err := Unmarshal([]byte(`1`), 0); err == nil {
+		t.Errorf("Unmarshal into non-pointer succeeded")
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	type Point struct {
+		X, Y int
+		z    int
+	}
+	const first = `((X 1) (Color (#C(1 -2) "red" (nested (list)))) (Y 2) (z 3))`
+	const input = first + ` ((X 3))`
+	var p Point
+	err := Unmarshal([]byte(first), &p)
+	want := `sexpr: unknown field Color in Go struct type sexpr.Point (at 1:9)`
+	if _, ok := err.(*UnknownFieldError); !ok || err.Error() != want {
+		t.Errorf("Unmarshal with unknown field: got %v, want %s", err, want)
+	}
+	var nested struct{ Points []Point }
+	err = Unmarshal([]byte(`((Points (((X 1)) ((z 2)))))`), &nested)
+	want = `sexpr: unknown field z in Go struct Points[1] of type sexpr.Point (at 1:21)`
+	if _, ok := err.(*UnknownFieldError); !ok || err.Error() != want {
+		t.Errorf("Unmarshal with unknown nested field: got %v, want %s", err, want)
+	}
+
+	p = Point{}
+	if err := (UnmarshalOptions{IgnoreUnknownFields: true}).Unmarshal([]byte(first), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p != (Point{X: 1, Y: 2}) {
+		t.Errorf("Unmarshal with IgnoreUnknownFields = %+v, want {X:1 Y:2}", p)
+	}
+
+	p = Point{}
+	dec := NewDecoder(strings.NewReader(input))
+	dec.IgnoreUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p != (Point{X: 1, Y: 2}) {
+		t.Errorf("Decode = %+v, want {X:1 Y:2}", p)
+	}
+	if err := dec.Decode(&p); err != nil || p.X != 3 {
+		t.Errorf("second Decode = %+v, %v", p, err)
+	}
+}
+
+func TestFieldTags(t *testing.T) {
+	type Base struct {
+		ID   int
+		Note string `sexpr:"note,omitempty"`
+	}
+	type Movie struct {
+		Base
+		Title  string   `sexpr:"title"`
+		Year   int      `sexpr:",omitempty"`
+		Oscars []string `sexpr:"oscars,omitempty"`
+		Cache  string   `sexpr:"-"`
+		Dash   string   `sexpr:"-,"`
+		First  string   `sexpr:"first-name,omitempty"`
+		Spaced string   `sexpr:"a b"` // not a symbol, so the name is ignored
+		rating int
+	}
+	for _, test := range []struct {
+		movie Movie
+		want  string
+	}{
+		{Movie{Base: Base{ID: 1}, Title: "Rope", Cache: "x", rating: 5},
+			`((ID 1) (title "Rope") (- "") (Spaced ""))`},
+		{Movie{Base: Base{ID: 2, Note: "n"}, Year: 1948, Oscars: []string{"none"}},
+			`((ID 2) (note "n") (title "") (Year 1948) (oscars ("none")) (- "") (Spaced ""))`},
+		{Movie{Title: "Rope", Dash: "d", First: "James"},
+			`((ID 0) (title "Rope") (- "d") (first-name "James") (Spaced ""))`},
+	} {
+		data, err := Marshal(test.movie)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", test.movie, data, test.want)
+		}
+	}
+
+	var movie Movie
+	err := Unmarshal([]byte(`((ID 3) (note "n") (title "Rope") (Year 1948) (- "d") (first-name "James"))`), &movie)
+	want := Movie{Base: Base{ID: 3, Note: "n"}, Title: "Rope", Year: 1948, Dash: "d", First: "James"}
+	if err != nil || !reflect.DeepEqual(movie, want) {
+		t.Errorf("Unmarshal = %+v, %v, want %+v", movie, err, want)
+	}
+	for _, input := range []string{`((Title "Rope"))`, `((Cache "x"))`, `((rating 5))`, `((Dash "d"))`} {
+		if err := Unmarshal([]byte(input), &movie); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want unknown field error", input)
+		}
+	}
+
+	dec := NewDecoder(strings.NewReader(`((TITLE "Rope") (id 4) (year 1948))`))
+	dec.IgnoreFieldCase()
+	movie = Movie{}
+	want = Movie{Base: Base{ID: 4}, Title: "Rope", Year: 1948}
+	if err := dec.Decode(&movie); err != nil || !reflect.DeepEqual(movie, want) {
+		t.Errorf("Decode with IgnoreFieldCase = %+v, %v, want %+v", movie, err, want)
+	}
+	movie = Movie{}
+	err = UnmarshalOptions{IgnoreFieldCase: true}.Unmarshal([]byte(`((TITLE "Rope") (id 4) (year 1948))`), &movie)
+	if err != nil || !reflect.DeepEqual(movie, want) {
+		t.Errorf("Unmarshal with IgnoreFieldCase = %+v, %v, want %+v", movie, err, want)
+	}
+	if err := Unmarshal([]byte(`((TITLE "Rope"))`), &movie); err == nil {
+		t.Errorf("Unmarshal without IgnoreFieldCase matched TITLE")
+	}
+}
+
+func TestFieldPromotion(t *testing.T) {
+	type A struct{ X, Y int }
+	type B struct{ X, Z int }
+	type C struct {
+		A
+		*B
+		Y string
+	}
+	// X is ambiguous, Y is hidden by the shallower C.Y,
+	// and Z is promoted through the nil pointer *B.
+	data, err := Marshal(C{A: A{1, 2}, Y: "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `((Y "y"))`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+	var c C
+	if err := Unmarshal([]byte(`((Z 3) (Y "y"))`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.B == nil || c.B.Z != 3 || c.Y != "y" {
+		t.Errorf("Unmarshal = %+v", c)
+	}
+}
+
+// A point encodes itself as (x y).
+type point struct{ X, Y int }
+
+func (p point) MarshalSExpr() ([]byte, error) {
+	return []byte(fmt.Sprintf("(%d %d)", p.X, p.Y)), nil
+}
+
+func (p *point) UnmarshalSExpr(data []byte) error {
+	var xy [2]int
+	if err := Unmarshal(data, &xy); err != nil {
+		return err
+	}
+	p.X, p.Y = xy[0], xy[1]
+	return nil
+}
+
+type badMarshaler struct{}
+
+func (badMarshaler) MarshalSExpr() ([]byte, error) { return []byte("(1 2"), nil }
+
+func TestMarshaler(t *testing.T) {
+	type Event struct {
+		At    time.Time
+		Where point
+		Path  []*point
+	}
+	at := time.Date(1964, time.January, 29, 12, 0, 0, 0, time.UTC)
+	event := Event{at, point{1, -2}, []*point{{3, 4}, nil}}
+	const want = `((At "1964-01-29T12:00:00Z") (Where (1 -2)) (Path ((3 4) nil)))`
+	data, err := Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+	data, err = MarshalIndent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("MarshalIndent = %s, want %s", data, want)
+	}
+
+	var got Event
+	input := `((At "1964-01-29T12:00:00Z") (Where (  1
+		-2 )) (Path ((3 4) nil)))`
+	if err := Unmarshal([]byte(input), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, event) {
+		t.Errorf("Unmarshal = %+v, want %+v", got, event)
+	}
+
+	if err := Unmarshal([]byte(`((At "yesterday"))`), &got); err == nil {
+		t.Errorf("Unmarshal of bad time succeeded")
+	}
+	if err := Unmarshal([]byte(`((Where (1 2 3)))`), &got); err == nil {
+		t.Errorf("Unmarshal of bad point succeeded")
+	}
+	if _, err := Marshal(badMarshaler{}); err == nil {
+		t.Errorf("Marshal of invalid MarshalSExpr output succeeded")
+	}
+}
+
+func TestSortedMapKeys(t *testing.T) {
+	type key struct {
+		A string
+		B int
+	}
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{map[int]bool{10: true, -1: false, 2: true}, `((-1 nil) (2 t) (10 t))`},
+		{map[uint8]int{200: 1, 3: 2}, `((3 2) (200 1))`},
+		{map[string]int{"b": 1, "B": 2, "a": 3}, `(("B" 2) ("a" 3) ("b" 1))`},
+		{map[float64]int{math.NaN(): 1, math.Inf(-1): 2, 0.5: 3}, `((NaN 1) (-Inf 2) (0.5 3))`},
+		{map[bool]int{true: 1, false: 0}, `((nil 0) (t 1))`},
+		{map[[2]int]int{{2, 1}: 1, {1, 2}: 2}, `(((1 2) 2) ((2 1) 1))`},
+		{map[key]int{{"b", 1}: 1, {"a", 2}: 2, {"a", 1}: 3},
+			`((((A "a") (B 1)) 3) (((A "a") (B 2)) 2) (((A "b") (B 1)) 1))`},
+		{map[interface{}]int{"x": 1, 2: 2, nil: 3, 1: 4},
+			`((nil 3) (("int" 1) 4) (("int" 2) 2) (("string" "x") 1))`},
+	} {
+		for i := 0; i < 5; i++ { // map iteration order varies
+			data, err := Marshal(test.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("Marshal(%v) = %s, want %s", test.v, data, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMarshalIndentOptions(t *testing.T) {
+	v := map[string][]int{"primes": {2, 3, 5, 7, 11, 13}, "squares": {1, 4, 9, 16}}
+	for _, test := range []struct {
+		opts MarshalIndentOptions
+		want string
+	}{
+		{MarshalIndentOptions{}, `(("primes" (2 3 5 7 11 13)) ("squares" (1 4 9 16)))`},
+		{MarshalIndentOptions{Width: 30}, `(("primes" (2 3 5 7 11 13))
+ ("squares" (1 4 9 16)))`},
+		{MarshalIndentOptions{Width: 20, Indent: 2}, `(("primes"
+   (2 3 5 7 11 13))
+  ("squares"
+    (1 4 9 16)))`},
+	} {
+		data, err := test.opts.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("%+v.Marshal() =\n%s\nwant\n%s", test.opts, data, test.want)
+		}
+	}
+}
+
+// ExamplePrinter lays out a nested call within 24 columns.
+func ExamplePrinter() {
+	p := NewPrinter(PrinterOptions{Width: 24, Indent: 2})
+	call := func(name string, args ...func()) {
+		p.Begin()
+		p.Text(name + "(")
+		for i, arg := range args {
+			if i > 0 {
+				p.Text(",")
+				p.Space()
+			}
+			arg()
+		}
+		p.Text(")")
+		p.End()
+	}
+	atom := func(s string) func() { return func() { p.Text(s) } }
+	call("max", func() { call("hypot", atom("x"), atom("y")) }, func() { call("abs", atom("z")) }, atom("threshold"))
+	fmt.Println(string(p.Bytes()))
+	// Output:
+	// max(hypot(x, y), abs(z),
+	//   threshold)
+}
+
+func TestPrinterOutsideGroup(t *testing.T) {
+	p := NewPrinter(PrinterOptions{Width: 8})
+	p.Text("a")
+	p.Space() // not in a group, so never broken
+	p.End()   // unmatched, so ignored
+	p.Begin()
+	p.Text("bbbb")
+	p.Space()
+	p.Text("cccc")
+	p.End()
+	p.Space()
+	p.Text("d")
+	if got, want := string(p.Bytes()), "a bbbb\n   cccc d"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+type node struct {
+	Name     string
+	Next     *node
+	Children []*node
+}
+
+func TestCycles(t *testing.T) {
+	a := &node{Name: "a"}
+	b := &node{Name: "b", Next: a}
+	a.Next = b
+	if _, err := Marshal(a); err == nil {
+		t.Errorf("Marshal of cyclic list succeeded")
+	}
+	if _, err := MarshalIndent(a); err == nil {
+		t.Errorf("MarshalIndent of cyclic list succeeded")
+	}
+	m := map[string]interface{}{}
+	m["self"] = m
+	if _, err := (MarshalOptions{Labels: true}).Marshal(m); err == nil {
+		t.Errorf("Marshal of cyclic map succeeded")
+	}
+
+	// Shared but acyclic pointers are encoded twice by default.
+	leaf := &node{Name: "leaf"}
+	tree := &node{Name: "root", Children: []*node{leaf, leaf}}
+	data, err := Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `((Name "root") (Next nil) (Children (((Name "leaf") (Next nil) (Children ())) ((Name "leaf") (Next nil) (Children ())))))`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{a, `#1=((Name "a") (Next ((Name "b") (Next #1#) (Children ()))) (Children ()))`},
+		{tree, `((Name "root") (Next nil) (Children (#1=((Name "leaf") (Next nil) (Children ())) #1#)))`},
+	} {
+		data, err := MarshalOptions{Labels: true}.Marshal(test.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("Marshal with labels = %s, want %s", data, test.want)
+		}
+		indented, err := MarshalIndentOptions{Width: 200, Labels: true}.Marshal(test.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(indented) != test.want {
+			t.Errorf("MarshalIndent with labels = %s, want %s", indented, test.want)
+		}
+	}
+
+	var got *node
+	if err := Unmarshal([]byte(`#1=((Name "a") (Next ((Name "b") (Next #1#))))`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "a" || got.Next.Name != "b" || got.Next.Next != got {
+		t.Errorf("Unmarshal did not restore the cycle: %+v", got)
+	}
+	got = nil
+	if err := Unmarshal([]byte(`((Children (#7=((Name "x")) #7# #7#)))`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if c := got.Children; len(c) != 3 || c[0] != c[1] || c[1] != c[2] || c[0].Name != "x" {
+		t.Errorf("Unmarshal did not restore sharing: %+v", c)
+	}
+
+	// A shared pointer within an interface.
+	Register(&node{})
+	v := []interface{}{leaf, leaf}
+	data, err = MarshalOptions{Labels: true}.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vs []interface{}
+	if err := Unmarshal(data, &vs); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	if len(vs) != 2 || vs[0] != vs[1] || vs[0].(*node).Name != "leaf" {
+		t.Errorf("Unmarshal(%s) = %v", data, vs)
+	}
+
+	for _, input := range []string{`#1#`, `(#1=((Name "x")) #1=((Name "y")))`, `#1=5`, `#1 ((Name "x"))`} {
+		var n *node
+		if err := Unmarshal([]byte(input), &n); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", input)
+		}
+	}
+	var s []*node
+	if err := Unmarshal([]byte(`(#1=((Name "x")) #1=((Name "y")))`), &s); err == nil {
+		t.Errorf("Unmarshal with duplicate label succeeded")
+	}
+
+	dec := NewDecoder(strings.NewReader(`#1=(a #1#)`))
+	var toks []Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		toks = append(toks, tok)
+	}
+	if want := []Token{Symbol("#1="), StartList{}, Symbol("a"), Symbol("#1#"), EndList{}}; !reflect.DeepEqual(toks, want) {
+		t.Errorf("Token = %v, want %v", toks, want)
+	}
+
+	// A generic Value keeps shared structure, but cannot be cyclic.
+	data, err = MarshalOptions{Labels: true}.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x interface{}
+	if err := Unmarshal(data, &x); err != nil {
+		t.Fatalf("Unmarshal(%s) into Value: %v", data, err)
+	}
+	children, _ := Lookup(x, "Children")
+	if c, ok := children.(List); !ok || len(c) != 2 || !reflect.DeepEqual(c[0], c[1]) ||
+		&c[0].(List)[0] != &c[1].(List)[0] {
+		t.Errorf("Unmarshal(%s) into Value: Children = %v, want two shared lists", data, children)
+	}
+	for _, input := range []string{`#1=(a #1#)`, `#1#`, `(#1=a #1=b)`, `#1 a`} {
+		if err := Unmarshal([]byte(input), &x); err == nil {
+			t.Errorf("Unmarshal(%s) into Value succeeded", input)
+		}
+	}
+}
+
+func TestReaderSyntax(t *testing.T) {
+	type Config struct {
+		Name  string
+		Mode  int
+		Mask  uint8
+		Delta int
+		Tags  []Symbol
+		Pair  Cons
+		Tree  *Cons
+	}
+	input := `; A configuration file.
+((Name "server") ; trailing comment
+ #| a block comment #| nested |# |#
+ (Mode #o755) (Mask #b10100000) (Delta #x-1f)
+ (Tags (alpha foo-bar <=))
+ (Pair (1 . 2))
+ (Tree ('x (a b . "c") -y (- 1) #C(0 1) 2.5 nil)))`
+	var got Config
+	if err := Unmarshal([]byte(input), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		Name:  "server",
+		Mode:  0755,
+		Mask:  0xa0,
+		Delta: -0x1f,
+		Tags:  []Symbol{"alpha", "foo-bar", "<="},
+		Pair:  Cons{Int(1), Int(2)},
+		Tree: listToCons([]interface{}{
+			[]interface{}{Symbol("quote"), Symbol("x")},
+			&Cons{Symbol("a"), &Cons{Symbol("b"), String("c")}},
+			Symbol("-y"),
+			[]interface{}{Symbol("-"), Int(1)},
+			complex(0, 1),
+			Float(2.5),
+			nil,
+		}, nil),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal =\n%#v\nwant\n%#v", got, want)
+	}
+
+	// A Cons encodes itself in list notation.
+	data, err := Marshal(want.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantTree = `((quote x) (a b . "c") -y (- 1) #C(0 1) 2.5 nil)`
+	if string(data) != wantTree {
+		t.Errorf("Marshal(Tree) = %s, want %s", data, wantTree)
+	}
+	var tree Cons
+	if err := Unmarshal(data, &tree); err != nil || !reflect.DeepEqual(&tree, want.Tree) {
+		t.Errorf("Unmarshal(%s) = %v, %v", data, tree, err)
+	}
+
+	for _, input := range []string{
+		`((Pair (. 2)))`,
+		`((Pair (1 . 2 3)))`,
+		`((Pair 1))`,
+		`((Mode #x))`,
+		`((Mode #xZZ))`,
+		`((Mode 1 #| unterminated))`,
+		`((Mode '1))`,
+		`((Tags (a . b)))`,
+	} {
+		var c Config
+		if err := Unmarshal([]byte(input), &c); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", input)
+		}
+	}
+}
+
+func TestDecoderTokenLisp(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("'(a . b) ; comment\n #x-10 #|x|# foo-bar"))
+	var got []Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+	}
+	want := []Token{
+		Quote{}, StartList{}, Symbol("a"), Dot{}, Symbol("b"), EndList{},
+		Int(-16), Symbol("foo-bar"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Token:\ngot  %#v\nwant %#v", got, want)
+	}
+}
+
+func TestValue(t *testing.T) {
+	const input = `((server ((host "localhost") (ports 80 443)))
+ ("log level" debug)
+ (timeout . 2.5))`
+	var v Value
+	if err := Unmarshal([]byte(input), &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path []string
+		want Value
+		ok   bool
+	}{
+		{[]string{"server", "host"}, String("localhost"), true},
+		{[]string{"server", "ports"}, List{Int(80), Int(443)}, true},
+		{[]string{"log level"}, Symbol("debug"), true},
+		{[]string{"timeout"}, Float(2.5), true},
+		{[]string{"server", "user"}, nil, false},
+		{[]string{"server", "host", "name"}, nil, false},
+		{[]string{}, v, true},
+	} {
+		got, ok := Lookup(v, test.path...)
+		if !reflect.DeepEqual(got, test.want) || ok != test.ok {
+			t.Errorf("Lookup(%q) = %#v, %t, want %#v, %t",
+				test.path, got, ok, test.want, test.ok)
+		}
+	}
+
+	data, err := MarshalValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `((server ((host "localhost") (ports 80 443))) ("log level" debug) (timeout . 2.5))`
+	if string(data) != want {
+		t.Errorf("MarshalValue = %s, want %s", data, want)
+	}
+
+	// An interface value decodes generically only at top level;
+	// a field of interface type still holds ("type" value).
+	var x interface{} = "stale"
+	if err := Unmarshal([]byte("nil"), &x); err != nil || x != nil {
+		t.Errorf("Unmarshal(nil) = %#v, %v", x, err)
+	}
+	var s struct{ X interface{} }
+	if err := Unmarshal([]byte(`((X ("int" 1)))`), &s); err != nil || s.X != 1 {
+		t.Errorf("Unmarshal(X) = %#v, %v", s.X, err)
+	}
+	dec := NewDecoder(strings.NewReader(`(a 1) "b"`))
+	var got []Value
+	for dec.More() {
+		var v Value
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+	if want := []Value{List{Symbol("a"), Int(1)}, String("b")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %#v, want %#v", got, want)
+	}
 }
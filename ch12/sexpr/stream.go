@@ -0,0 +1,150 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"io"
+	"strconv"
+	"text/scanner"
+)
+
+// A Decoder reads and decodes S-expressions from an input stream.
+//
+// Decode and Token may be freely interleaved: for example, a caller
+// may read the StartList of a long list with Token, decode each
+// element with Decode while More reports true, then read the EndList.
+//
+// The Decoder reads one token ahead of the value most recently
+// returned, so it may block on an interactive stream.
+type Decoder struct {
+	lex           lexer
+	started       bool // whether the first token has been scanned
+	ignoreUnknown bool // whether Decode skips unknown struct fields
+	foldNames     bool // whether Decode matches field names case-insensitively
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	dec := new(Decoder)
+	dec.lex.init(r)
+	return dec
+}
+
+// IgnoreUnknownFields causes subsequent calls to Decode to skip
+// struct fields that are absent from, or unexported in, the
+// destination type, instead of returning an *UnknownFieldError,
+// as does UnmarshalOptions.IgnoreUnknownFields.
+func (dec *Decoder) IgnoreUnknownFields() { dec.ignoreUnknown = true }
+
+// IgnoreFieldCase causes subsequent calls to Decode to match
+// field names that differ from the struct field names, or their
+// tagged names, only in case, as does UnmarshalOptions.IgnoreFieldCase.
+func (dec *Decoder) IgnoreFieldCase() { dec.foldNames = true }
+
+func (dec *Decoder) start() {
+	if !dec.started {
+		dec.lex.next() // get the first token
+		dec.started = true
+	}
+}
+
+// Decode reads the next S-expression from the input and stores it
+// in the variable whose address is in the non-nil pointer out.
+// At the end of the input, Decode returns io.EOF.
+func (dec *Decoder) Decode(out interface{}) error {
+	dec.start()
+	if dec.lex.token == scanner.EOF && dec.lex.err == "" {
+		return io.EOF
+	}
+	d := &decodeState{lex: &dec.lex, ignoreUnknown: dec.ignoreUnknown, foldNames: dec.foldNames}
+	return d.unmarshal(out)
+}
+
+// More reports whether there is another element
+// in the current list, or another value in the input.
+func (dec *Decoder) More() bool {
+	dec.start()
+	return dec.lex.token != ')' && dec.lex.token != scanner.EOF
+}
+
+// A Token holds a value of one of these types:
+//
+//	Symbol     a symbol, e.g., nil, Title, foo-bar, <=, #C or #1=
+//	String     a string literal, e.g., "hello"
+//	Int        an integer literal, e.g., -42 or #x2A
+//	Float      a floating-point literal, e.g., 1.5, +Inf or NaN
+//	StartList  an opening parenthesis
+//	EndList    a closing parenthesis
+//	Quote      a quote mark, which prefixes a value, as in 'x
+//	Dot        the dot of a dotted list, as in (a . b)
+//
+// Comments are skipped.
+type Token interface{}
+
+type (
+	Symbol    string
+	String    string
+	Int       int64
+	Float     float64
+	StartList struct{}
+	EndList   struct{}
+	Quote     struct{}
+	Dot       struct{}
+)
+
+// Token returns the next token in the input stream.
+// At the end of the input, Token returns nil, io.EOF.
+func (dec *Decoder) Token() (Token, error) {
+	dec.start()
+	lex := &dec.lex
+	pos := lex.pos
+	if lex.err != "" {
+		return nil, syntaxErrorAt(pos, "%s", lex.err)
+	}
+	d := &decodeState{lex: lex}
+	var tok Token
+	switch lex.token {
+	case '(':
+		tok = StartList{}
+	case ')':
+		tok = EndList{}
+	case '\'':
+		tok = Quote{}
+	case '.':
+		tok = Dot{}
+	case scanner.Ident:
+		if lex.text() == "nil" {
+			tok = Symbol("nil")
+			break
+		}
+		return d.readDatum()
+	case scanner.String, scanner.RawString:
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return nil, syntaxErrorAt(pos, "%v", err)
+		}
+		tok = String(s)
+	case '#': // e.g., #C, #1= or #1#
+		lex.next()
+		switch lex.token {
+		case scanner.Ident:
+			tok = Symbol("#" + lex.text())
+		case scanner.Int:
+			n := lex.text()
+			lex.next()
+			if lex.token != '=' && lex.token != '#' {
+				return nil, syntaxErrorAt(pos, "unexpected token %q after #%s", lex.text(), n)
+			}
+			tok = Symbol("#" + n + lex.text())
+		default:
+			return nil, syntaxErrorAt(pos, "unexpected token %q after #", lex.text())
+		}
+	case scanner.EOF:
+		return nil, io.EOF
+	default: // numbers and symbols
+		return d.readDatum()
+	}
+	lex.next()
+	return tok, nil
+}
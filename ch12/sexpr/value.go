@@ -0,0 +1,115 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// A Value is an S-expression decoded without a target type.
+// Unmarshal and Decode produce one when the destination is a
+// *interface{}, in the same way they fill the fields of a Cons.
+// Its dynamic type is one of
+//
+//	nil          for nil and ()
+//	Symbol       for t, x, foo-bar and so on
+//	String       for "hello"
+//	Int          for 42 and #x2A
+//	Float        for 1.5 and NaN
+//	complex128   for #C(1 2)
+//	List         for (a b c), and 'x, which is (quote x)
+//	*Cons        for a dotted list, (a b . c)
+//
+// An interface value encoded by Marshal as ("type" value)
+// decodes as a List of a String and a Value, and a non-nil pointer
+// to false or nil, encoded as 'nil, as List{Symbol("quote"), nil}.
+// A labelled value, #n=x, decodes as x, and each reference to it,
+// #n#, as the same Value; a reference within x itself, which only
+// a cyclic structure has, is an error.
+type Value = interface{}
+
+// A List is a proper list of Values.
+type List = []interface{}
+
+// MarshalValue encodes v, a Value, in S-expression form.
+// Values of other types within v are encoded as by Marshal.
+func MarshalValue(v Value) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeDatum(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Lookup returns the value found by following path through
+// nested association lists of the form ((key value) ...),
+// and reports whether it was found. At each step, the value must
+// be a List whose elements are lists, or pairs, each headed by a
+// Symbol or String key; the first whose key equals the path
+// element is chosen, and its value is its second element, or
+// the List of its remaining elements if it has more than two.
+// With an empty path, Lookup returns v.
+//
+// For example, given the Value of
+//
+//	((server ((host "localhost") (ports 80 443))))
+//
+// Lookup(v, "server", "host") returns String("localhost"), and
+// Lookup(v, "server", "ports") returns List{Int(80), Int(443)}.
+func Lookup(v Value, path ...string) (Value, bool) {
+	for _, key := range path {
+		list, ok := v.(List)
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for _, entry := range list {
+			if value, ok := entryValue(entry, key); ok {
+				v, found = value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// entryValue returns the value of an association list entry,
+// (key value), (key value...) or (key . value), if its key is key.
+func entryValue(entry Value, key string) (Value, bool) {
+	var head, value Value
+	switch entry := entry.(type) {
+	case List:
+		if len(entry) < 2 {
+			return nil, false
+		}
+		head, value = entry[0], entry[1]
+		if len(entry) > 2 {
+			value = entry[1:]
+		}
+	case *Cons:
+		if entry == nil {
+			return nil, false
+		}
+		head, value = entry.Car, entry.Cdr
+	default:
+		return nil, false
+	}
+	switch head := head.(type) {
+	case Symbol:
+		return value, string(head) == key
+	case String:
+		return value, string(head) == key
+	}
+	return nil, false
+}
+
+// isValue reports whether v, the target of a decoding,
+// is an empty interface, which receives a Value.
+func isValue(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && v.NumMethod() == 0
+}
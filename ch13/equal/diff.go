@@ -0,0 +1,229 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"gopl.io/ch12/format"
+)
+
+// A Difference records one place where two values differ.
+type Difference struct {
+	Path string        // location, in the notation of gopl.io/ch12/display
+	X, Y reflect.Value // the values at Path; invalid if absent
+	Kind Mismatch
+}
+
+// A Mismatch is the kind of a Difference.
+type Mismatch int
+
+const (
+	TypeMismatch  Mismatch = iota // the values have different types
+	ValueMismatch                 // the values are different atoms
+	NilMismatch                   // only one of the values is nil
+	OnlyInX                       // an element or map entry is missing from y
+	OnlyInY                       // an element or map entry is missing from x
+)
+
+func (m Mismatch) String() string {
+	switch m {
+	case TypeMismatch:
+		return "type"
+	case ValueMismatch:
+		return "value"
+	case NilMismatch:
+		return "nil"
+	case OnlyInX:
+		return "only in x"
+	case OnlyInY:
+		return "only in y"
+	}
+	return fmt.Sprintf("Mismatch(%d)", int(m))
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case TypeMismatch:
+		return fmt.Sprintf("%s: type %s != %s", d.Path, typeString(d.X), typeString(d.Y))
+	case OnlyInX:
+		return fmt.Sprintf("%s: only in x: %s", d.Path, format.Atom(d.X))
+	case OnlyInY:
+		return fmt.Sprintf("%s: only in y: %s", d.Path, format.Atom(d.Y))
+	}
+	return fmt.Sprintf("%s: %s != %s", d.Path, format.Atom(d.X), format.Atom(d.Y))
+}
+
+func typeString(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	return v.Type().String()
+}
+
+// Diff returns the differences between x and y, which are empty
+// if and only if x and y are deeply equal, as defined by Equal.
+// Paths begin with "x". Within a slice or array, each element is
+// compared with the element at the same index; elements beyond
+// the end of the shorter one are OnlyInX or OnlyInY. Differences
+// between map entries come first for keys in both maps, then for keys
+// only in x, then only in y, each in key order, as by format.Compare.
+// Keys in paths are formatted as by format.Key, such as x[main.P{X: 1}].
+func Diff(x, y interface{}) []Difference {
+	return DiffWith(x, y)
+}
+
+// A differ holds the state of a single call to Diff, DiffWith or EqualWith.
+type differ struct {
+	config
+	seen  map[comparison]bool
+	diffs []Difference
+	first bool // stop at the first difference
+}
+
+func newDiffer(opts []Option) *differ {
+	d := &differ{seen: make(map[comparison]bool)}
+	for _, opt := range opts {
+		opt(&d.config)
+	}
+	return d
+}
+
+func (d *differ) report(path string, x, y reflect.Value, kind Mismatch) {
+	if d.ignorePaths[path] {
+		return
+	}
+	d.diffs = append(d.diffs, Difference{path, x, y, kind})
+}
+
+// diff records the differences between x and y, whose location is path.
+// It follows the same logic as equal, modified by the options.
+func (d *differ) diff(path string, x, y reflect.Value) {
+	if d.first && len(d.diffs) > 0 || d.ignorePaths[path] {
+		return
+	}
+	if !x.IsValid() || !y.IsValid() {
+		if x.IsValid() != y.IsValid() {
+			d.report(path, x, y, TypeMismatch)
+		}
+		return
+	}
+	if x.Type() != y.Type() {
+		d.report(path, x, y, TypeMismatch)
+		return
+	}
+
+	// cycle check
+	if x.CanAddr() && y.CanAddr() {
+		xptr := unsafe.Pointer(x.UnsafeAddr())
+		yptr := unsafe.Pointer(y.UnsafeAddr())
+		if xptr == yptr {
+			return // identical references
+		}
+		c := comparison{xptr, yptr, x.Type()}
+		if d.seen[c] {
+			return // already seen
+		}
+		d.seen[c] = true
+	}
+
+	if fn, ok := d.comparators[x.Type()]; ok {
+		if xi, yi := exported(x), exported(y); xi.IsValid() && yi.IsValid() {
+			if !fn.Call([]reflect.Value{xi, yi})[0].Bool() {
+				d.report(path, x, y, ValueMismatch)
+			}
+			return
+		}
+	}
+
+	switch x.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if x.IsNil() != y.IsNil() {
+			d.report(path, x, y, NilMismatch)
+			return
+		}
+		if x.Kind() == reflect.Ptr {
+			d.diff("(*"+path+")", x.Elem(), y.Elem())
+		} else {
+			d.diff(path+".value", x.Elem(), y.Elem())
+		}
+
+	case reflect.Array, reflect.Slice:
+		if x.Kind() == reflect.Slice && d.nilNotEmpty && x.IsNil() != y.IsNil() {
+			d.report(path, x, y, NilMismatch)
+			return
+		}
+		for i := 0; i < x.Len() || i < y.Len(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= y.Len():
+				d.report(elemPath, x.Index(i), reflect.Value{}, OnlyInX)
+			case i >= x.Len():
+				d.report(elemPath, reflect.Value{}, y.Index(i), OnlyInY)
+			default:
+				d.diff(elemPath, x.Index(i), y.Index(i))
+			}
+		}
+
+	case reflect.Struct:
+		for i, n := 0, x.NumField(); i < n; i++ {
+			name := x.Type().Field(i).Name
+			if d.ignoreFields[name] {
+				continue
+			}
+			d.diff(path+"."+name, x.Field(i), y.Field(i))
+		}
+
+	case reflect.Map:
+		if d.nilNotEmpty && x.IsNil() != y.IsNil() {
+			d.report(path, x, y, NilMismatch)
+			return
+		}
+		pairs, onlyX, onlyY := matchKeys(x, y, func(key, x, y reflect.Value) bool {
+			return d.valueEqual(keyPath(path, key), x, y)
+		})
+		sortKeys(pairs, onlyX, onlyY)
+		for _, p := range pairs {
+			d.diff(keyPath(path, p.key), p.x, p.y)
+		}
+		for _, e := range onlyX {
+			d.report(keyPath(path, e.key), e.value, reflect.Value{}, OnlyInX)
+		}
+		for _, e := range onlyY {
+			d.report(keyPath(path, e.key), reflect.Value{}, e.value, OnlyInY)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if !d.floatEqual(x.Float(), y.Float(), x.Type().Bits()) {
+			d.report(path, x, y, ValueMismatch)
+		}
+
+	case reflect.Complex64, reflect.Complex128:
+		bits := x.Type().Bits() / 2
+		xc, yc := x.Complex(), y.Complex()
+		if !d.floatEqual(real(xc), real(yc), bits) || !d.floatEqual(imag(xc), imag(yc), bits) {
+			d.report(path, x, y, ValueMismatch)
+		}
+
+	default: // basic types, channels, funcs, unsafe pointers
+		// Not d.seen, which already holds x and y.
+		if !equal(x, y, make(map[comparison]bool)) {
+			d.report(path, x, y, ValueMismatch)
+		}
+	}
+}
+
+// valueEqual reports whether x and y, at path, are equal under
+// d's options, without recording any differences.
+func (d *differ) valueEqual(path string, x, y reflect.Value) bool {
+	sub := &differ{config: d.config, seen: make(map[comparison]bool), first: true}
+	sub.diff(path, x, y)
+	return len(sub.diffs) == 0
+}
+
+func keyPath(path string, key reflect.Value) string {
+	return fmt.Sprintf("%s[%s]", path, format.Key(key))
+}
@@ -94,8 +94,14 @@ func equal(x, y reflect.Value, seen map[comparison]bool) bool {
 		if x.Len() != y.Len() {
 			return false
 		}
-		for _, k := range x.MapKeys() {
-			if !equal(x.MapIndex(k), y.MapIndex(k), seen) {
+		pairs, onlyX, onlyY := matchKeys(x, y, func(_, x, y reflect.Value) bool {
+			return equal(x, y, make(map[comparison]bool))
+		})
+		if len(onlyX) > 0 || len(onlyY) > 0 {
+			return false
+		}
+		for _, p := range pairs {
+			if !equal(p.x, p.y, seen) {
 				return false
 			}
 		}
@@ -111,8 +117,11 @@ func equal(x, y reflect.Value, seen map[comparison]bool) bool {
 // Equal reports whether x and y are deeply equal.
 //!-comparison
 //
-// Map keys are always compared with ==, not deeply.
-// (This matters for keys containing pointers or interfaces.)
+// Map keys are compared deeply, so two maps whose keys are distinct
+// pointers to equal values are equal. A key that is not equal to
+// itself, such as NaN, matches no key. Keys that are not == to any
+// key of the other map are compared with each of its such keys, so
+// comparing large maps keyed by pointers takes quadratic time.
 //!+comparison
 func Equal(x, y interface{}) bool {
 	seen := make(map[comparison]bool)
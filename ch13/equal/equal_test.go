@@ -5,8 +5,12 @@ package equal
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEqual(t *testing.T) {
@@ -90,6 +94,9 @@ func TestEqual(t *testing.T) {
 			t.Errorf("Equal(%v, %v) = %t",
 				test.x, test.y, !test.want)
 		}
+		if d := Diff(test.x, test.y); (len(d) == 0) != test.want {
+			t.Errorf("Diff(%v, %v) = %v", test.x, test.y, d)
+		}
 	}
 }
 
@@ -131,3 +138,231 @@ func Example_equalCycle() {
 	// false
 	// false
 }
+
+func TestMapKeysDeep(t *testing.T) {
+	one, oneAgain, two := 1, 1, 2
+	for _, test := range []struct {
+		x, y interface{}
+		want bool
+	}{
+		{map[*int]string{&one: "a"}, map[*int]string{&oneAgain: "a"}, true},
+		{map[*int]string{&one: "a"}, map[*int]string{&two: "a"}, false},
+		{map[*int]string{&one: "a"}, map[*int]string{&oneAgain: "b"}, false},
+		{map[interface{}]int{&one: 1, 1: 2}, map[interface{}]int{1: 2, &oneAgain: 1}, true},
+		{map[float64]int{math.NaN(): 1}, map[float64]int{math.NaN(): 1}, false},
+	} {
+		if Equal(test.x, test.y) != test.want {
+			t.Errorf("Equal(%v, %v) = %t", test.x, test.y, !test.want)
+		}
+	}
+
+	// Keys that are deeply equal to several keys of the other map
+	// are paired by their values too, regardless of iteration order.
+	p1, p2, q1, q2 := new(int), new(int), new(int), new(int)
+	x := map[*int]int{p1: 1, p2: 2}
+	y := map[*int]int{q1: 1, q2: 2}
+	z := map[*int]int{q1: 1, q2: 3}
+	for i := 0; i < 200; i++ {
+		if !Equal(x, y) {
+			t.Fatalf("Equal(x, y) = false on run %d", i)
+		}
+		if d := Diff(x, y); len(d) != 0 {
+			t.Fatalf("Diff(x, y) = %v on run %d", d, i)
+		}
+		if Equal(x, z) {
+			t.Fatalf("Equal(x, z) = true on run %d", i)
+		}
+		if d := Diff(x, z); len(d) != 1 || d[0].Kind != ValueMismatch ||
+			d[0].X.Int() != 2 || d[0].Y.Int() != 3 {
+			t.Fatalf("Diff(x, z) = %v on run %d", d, i)
+		}
+	}
+	if !EqualWith(map[*int]float64{p1: 1, p2: 2}, map[*int]float64{q1: 2.01, q2: 1.01}, FloatEpsilon(0.1)) {
+		t.Error("EqualWith(FloatEpsilon) = false for maps with deeply equal keys")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	type Movie struct {
+		Title  string
+		Year   int
+		Actor  map[string]string
+		Oscars []string
+		Sequel *string
+		Extra  interface{}
+	}
+	sequel := "none"
+	x := Movie{
+		Title: "Dr. Strangelove",
+		Year:  1964,
+		Actor: map[string]string{
+			"Dr. Strangelove":      "Peter Sellers",
+			"Pres. Merkin Muffley": "Peter Sellers",
+			"Gen. Buck Turgidson":  "George C. Scott",
+		},
+		Oscars: []string{"Best Actor (Nomin.)", "Best Picture (Nomin.)"},
+		Extra:  1,
+	}
+	y := x
+	y.Year = 1965
+	y.Actor = map[string]string{
+		"Dr. Strangelove":      "Sellers",
+		"Pres. Merkin Muffley": "Peter Sellers",
+		"Maj. T.J. Kong":       "Slim Pickens",
+	}
+	y.Oscars = []string{"Best Actor (Nomin.)"}
+	y.Sequel = &sequel
+	y.Extra = "1"
+
+	var got []string
+	for _, d := range Diff(x, y) {
+		got = append(got, fmt.Sprintf("%s (%s)", d, d.Kind))
+	}
+	want := []string{
+		`x.Year: 1964 != 1965 (value)`,
+		`x.Actor["Dr. Strangelove"]: "Peter Sellers" != "Sellers" (value)`,
+		`x.Actor["Gen. Buck Turgidson"]: only in x: "George C. Scott" (only in x)`,
+		`x.Actor["Maj. T.J. Kong"]: only in y: "Slim Pickens" (only in y)`,
+		`x.Oscars[1]: only in x: "Best Picture (Nomin.)" (only in x)`,
+		`x.Sequel: *string 0x0 != *string 0x` + fmt.Sprintf("%x", &sequel) + ` (nil)`,
+		`x.Extra.value: type int != string (type)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff:\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Diff is empty exactly when Equal holds, even for cyclic values.
+	type link struct {
+		value string
+		tail  *link
+	}
+	a, b, c := &link{value: "a"}, &link{value: "b"}, &link{value: "c"}
+	a.tail, b.tail, c.tail = b, a, c
+	if d := Diff(a, a); len(d) != 0 {
+		t.Errorf("Diff(a, a) = %v", d)
+	}
+	want = []string{
+		`(*x).value: "a" != "c"`,
+		`(*(*x).tail).value: "b" != "c"`,
+	}
+	got = nil
+	for _, d := range Diff(a, c) {
+		got = append(got, d.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff(a, c):\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if d := Diff(1, nil); len(d) != 1 || d[0].String() != "x: type int != nil" {
+		t.Errorf("Diff(1, nil) = %v", d)
+	}
+
+	// Struct and array keys are reported in order, and by their fields.
+	type P struct{ X, Y int }
+	want = []string{
+		`x[equal.P{X: 1, Y: 2}]: 1 != 5`,
+		`x[equal.P{X: 2, Y: 0}]: 3 != 6`,
+		`x[equal.P{X: 1, Y: 3}]: only in x: 2`,
+		`x[equal.P{X: 3, Y: 1}]: only in y: 7`,
+	}
+	for i := 0; i < 20; i++ {
+		got = nil
+		for _, d := range Diff(
+			map[P]int{{1, 2}: 1, {1, 3}: 2, {2, 0}: 3, {4, 4}: 4},
+			map[P]int{{1, 2}: 5, {2, 0}: 6, {3, 1}: 7, {4, 4}: 4}) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("Diff(map[P]int):\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+	got = nil
+	for _, d := range Diff(map[[2]int]bool{{0, 1}: true, {1, 0}: true}, map[[2]int]bool{{0, 1}: false, {1, 0}: false}) {
+		got = append(got, d.String())
+	}
+	want = []string{`x[[2]int{0, 1}]: true != false`, `x[[2]int{1, 0}]: true != false`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff(map[[2]int]bool):\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEqualWith(t *testing.T) {
+	type Record struct {
+		Name    string
+		Score   float64
+		Updated time.Time
+		Tags    []string
+		phase   complex64
+	}
+	now := time.Now()
+	r := Record{Name: "a", Score: 0.3, Updated: now, Tags: []string{}}
+	withScore := func(f float64) Record { r := r; r.Score = f; return r }
+	withTime := r
+	withTime.Updated = now.Add(time.Hour)
+	withNilTags := r
+	withNilTags.Tags = nil
+	withPhase := r
+	withPhase.phase = complex(float32(math.Nextafter32(1, 2)), 0)
+	r1 := r
+	r1.phase = 1
+	sameInstant := func(x, y time.Time) bool { return x.Equal(y) }
+	tenth, fifth := 0.1, 0.2
+
+	for _, test := range []struct {
+		x, y interface{}
+		opts []Option
+		want bool
+	}{
+		{r, r, nil, true},
+		{r, withScore(tenth + fifth), nil, false},
+		{r, withScore(tenth + fifth), []Option{FloatEpsilon(1e-9)}, true},
+		{r, withScore(tenth + fifth), []Option{FloatULPs(1)}, true},
+		{r, withScore(0.3001), []Option{FloatULPs(1000)}, false},
+		{r, withScore(0.3001), []Option{FloatEpsilon(1e-3)}, true},
+		{withScore(math.NaN()), withScore(math.NaN()), nil, false},
+		{withScore(math.NaN()), withScore(math.NaN()), []Option{NaNEqual()}, true},
+		{withScore(math.NaN()), withScore(0), []Option{NaNEqual()}, false},
+		{float32(1), math.Nextafter32(1, 2), []Option{FloatULPs(1)}, true},
+		{float32(1), math.Nextafter32(math.Nextafter32(1, 2), 2), []Option{FloatULPs(1)}, false},
+		{-0.0, 0.0, nil, true},
+		{math.Nextafter(0, -1), math.Nextafter(0, 1), []Option{FloatULPs(2)}, true},
+		{r1, withPhase, nil, false},
+		{r1, withPhase, []Option{FloatULPs(1)}, true},
+		{r, withTime, nil, false},
+		{r, withTime, []Option{IgnoreFields("Updated")}, true},
+		{r, withTime, []Option{IgnorePaths("x.Updated")}, true},
+		{&r, &withTime, []Option{IgnorePaths("x.Updated")}, false},
+		{&r, &withTime, []Option{IgnorePaths("(*x).Updated")}, true},
+		{r, withNilTags, nil, true},
+		{r, withNilTags, []Option{NilNotEmpty()}, false},
+		{map[string]int{}, map[string]int(nil), []Option{NilNotEmpty()}, false},
+		{[]int(nil), []int(nil), []Option{NilNotEmpty()}, true},
+		{r, withTime, []Option{Comparator(func(x, y time.Time) bool { return true })}, true},
+		// Comparators apply to unexported fields and interface types.
+		{now, now.In(time.UTC), nil, false},
+		{now, now.In(time.UTC), []Option{Comparator(sameInstant)}, true},
+		{
+			[]error{errors.New("x")}, []error{errors.New("x")},
+			[]Option{Comparator(func(x, y error) bool { return x.Error() == y.Error() })},
+			true,
+		},
+		{
+			&struct{ t time.Time }{now}, &struct{ t time.Time }{now.In(time.UTC)},
+			[]Option{Comparator(sameInstant)},
+			true,
+		},
+	} {
+		if got := EqualWith(test.x, test.y, test.opts...); got != test.want {
+			t.Errorf("EqualWith(%v, %v, %d options) = %t", test.x, test.y, len(test.opts), got)
+		}
+		if d := DiffWith(test.x, test.y, test.opts...); (len(d) == 0) != test.want {
+			t.Errorf("DiffWith(%v, %v, %d options) = %v", test.x, test.y, len(test.opts), d)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Comparator(func(int) bool) did not panic")
+		}
+	}()
+	Comparator(func(int) bool { return true })
+}
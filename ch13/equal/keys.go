@@ -0,0 +1,135 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"reflect"
+	"sort"
+
+	"gopl.io/ch12/format"
+)
+
+// An entry is a key and its value in a map.
+type entry struct{ key, value reflect.Value }
+
+// A pair holds the values of corresponding keys of two maps.
+type pair struct{ key, x, y reflect.Value }
+
+// matchKeys pairs the entries of map x with those of map y, which has
+// the same type. Keys are first looked up with ==. The entries left
+// over are paired so that as many pairs as possible have deeply equal
+// keys and values, as reported by valueEqual, which is also given the
+// key in x; this is a maximum bipartite matching, found by augmenting
+// paths, so the result does not depend on the order of map iteration.
+// Any remaining entries whose keys are deeply equal are then paired
+// in key order, so that their values may be compared.
+//
+// It returns the pairs, and the entries of each map that have
+// no counterpart in the other.
+//
+// Every entry of x left over after the == lookup is compared deeply
+// with every one left over in y, so for n and m such entries the cost
+// is O(n·m) deep comparisons, which is quadratic in the size of maps
+// keyed by pointers, since their keys are never ==.
+func matchKeys(x, y reflect.Value, valueEqual func(key, x, y reflect.Value) bool) (pairs []pair, onlyX, onlyY []entry) {
+	var restX, restY []entry
+	for iter := y.MapRange(); iter.Next(); {
+		if !x.MapIndex(iter.Key()).IsValid() {
+			restY = append(restY, entry{iter.Key(), iter.Value()})
+		}
+	}
+	for iter := x.MapRange(); iter.Next(); {
+		if yv := y.MapIndex(iter.Key()); yv.IsValid() {
+			pairs = append(pairs, pair{iter.Key(), iter.Value(), yv})
+		} else {
+			restX = append(restX, entry{iter.Key(), iter.Value()})
+		}
+	}
+	if len(restX) == 0 || len(restY) == 0 {
+		return pairs, restX, restY
+	}
+
+	// edges[i] lists the entries of restY whose key and value
+	// are deeply equal to those of restX[i].
+	edges := make([][]int, len(restX))
+	for i, ex := range restX {
+		for j, ey := range restY {
+			if equal(ex.key, ey.key, make(map[comparison]bool)) && valueEqual(ex.key, ex.value, ey.value) {
+				edges[i] = append(edges[i], j)
+			}
+		}
+	}
+	matchY := make([]int, len(restY)) // index in restX of the match, or -1
+	for j := range matchY {
+		matchY[j] = -1
+	}
+	var augment func(i int, visited []bool) bool
+	augment = func(i int, visited []bool) bool {
+		for _, j := range edges[i] {
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+			if matchY[j] < 0 || augment(matchY[j], visited) {
+				matchY[j] = i
+				return true
+			}
+		}
+		return false
+	}
+	for i := range restX {
+		augment(i, make([]bool, len(restY)))
+	}
+	matchedX := make([]bool, len(restX))
+	for j, i := range matchY {
+		if i >= 0 {
+			matchedX[i] = true
+			pairs = append(pairs, pair{restX[i].key, restX[i].value, restY[j].value})
+		}
+	}
+	for i, e := range restX {
+		if !matchedX[i] {
+			onlyX = append(onlyX, e)
+		}
+	}
+	for j, e := range restY {
+		if matchY[j] < 0 {
+			onlyY = append(onlyY, e)
+		}
+	}
+
+	// Pair the remaining entries by key alone.
+	sortEntries(onlyX)
+	sortEntries(onlyY)
+	var unmatched []entry
+	for _, ex := range onlyX {
+		j := 0
+		for j < len(onlyY) && !equal(ex.key, onlyY[j].key, make(map[comparison]bool)) {
+			j++
+		}
+		if j == len(onlyY) {
+			unmatched = append(unmatched, ex)
+			continue
+		}
+		pairs = append(pairs, pair{ex.key, ex.value, onlyY[j].value})
+		onlyY = append(onlyY[:j], onlyY[j+1:]...)
+	}
+	return pairs, unmatched, onlyY
+}
+
+// sortKeys sorts the results of matchKeys by key, as by format.Compare,
+// so that differences are reported in a stable order.
+func sortKeys(pairs []pair, onlyX, onlyY []entry) {
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return format.Compare(pairs[i].key, pairs[j].key) < 0
+	})
+	sortEntries(onlyX)
+	sortEntries(onlyY)
+}
+
+func sortEntries(entries []entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return format.Compare(entries[i].key, entries[j].key) < 0
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// An Option modifies the comparison made by EqualWith or DiffWith.
+type Option func(*config)
+
+// A config holds the options of a comparison.
+type config struct {
+	epsilon      float64
+	ulps         uint64
+	nanEqual     bool
+	ignoreFields map[string]bool
+	ignorePaths  map[string]bool
+	nilNotEmpty  bool
+	comparators  map[reflect.Type]reflect.Value // func(T, T) bool
+}
+
+// EqualWith reports whether x and y are deeply equal,
+// as defined by Equal but modified by opts.
+func EqualWith(x, y interface{}, opts ...Option) bool {
+	d := newDiffer(opts)
+	d.first = true
+	d.diff("x", reflect.ValueOf(x), reflect.ValueOf(y))
+	return len(d.diffs) == 0
+}
+
+// DiffWith is like Diff, but compares values as EqualWith does.
+func DiffWith(x, y interface{}, opts ...Option) []Difference {
+	d := newDiffer(opts)
+	d.diff("x", reflect.ValueOf(x), reflect.ValueOf(y))
+	return d.diffs
+}
+
+// FloatEpsilon treats floating-point numbers, and the parts of
+// complex numbers, as equal if they differ by at most epsilon.
+func FloatEpsilon(epsilon float64) Option {
+	return func(c *config) { c.epsilon = epsilon }
+}
+
+// FloatULPs treats floating-point numbers, and the parts of complex
+// numbers, as equal if at most n representable values of their
+// type lie between them, that is, if they are at most n units in
+// the last place apart. Unlike FloatEpsilon, this tolerance is
+// relative to the magnitude of the numbers.
+func FloatULPs(n uint) Option {
+	return func(c *config) { c.ulps = uint64(n) }
+}
+
+// NaNEqual treats any two NaNs as equal. Map keys are still
+// compared exactly, so a NaN key matches no key.
+func NaNEqual() Option {
+	return func(c *config) { c.nanEqual = true }
+}
+
+// IgnoreFields skips struct fields with the given names,
+// in structs of any type.
+func IgnoreFields(names ...string) Option {
+	return func(c *config) {
+		if c.ignoreFields == nil {
+			c.ignoreFields = make(map[string]bool)
+		}
+		for _, name := range names {
+			c.ignoreFields[name] = true
+		}
+	}
+}
+
+// IgnorePaths skips the values at the given paths, written as
+// in a Difference, such as x.Actor["Dr. Strangelove"] or (*x).Next.
+func IgnorePaths(paths ...string) Option {
+	return func(c *config) {
+		if c.ignorePaths == nil {
+			c.ignorePaths = make(map[string]bool)
+		}
+		for _, path := range paths {
+			c.ignorePaths[path] = true
+		}
+	}
+}
+
+// NilNotEmpty treats a nil slice or map as different
+// from an empty non-nil one.
+func NilNotEmpty() Option {
+	return func(c *config) { c.nilNotEmpty = true }
+}
+
+// Comparator compares values of type T using fn, which must have
+// type func(T, T) bool and report whether its arguments are equal,
+// in place of the usual comparison. It panics if fn has any other
+// type. It is not applied to values of unexported fields that
+// are not addressable, such as those within map values.
+func Comparator(fn interface{}) Option {
+	f := reflect.ValueOf(fn)
+	t := f.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.In(0) != t.In(1) ||
+		t.NumOut() != 1 || t.Out(0).Kind() != reflect.Bool || t.IsVariadic() {
+		panic(fmt.Sprintf("equal.Comparator: got %s, want func(T, T) bool", t))
+	}
+	return func(c *config) {
+		if c.comparators == nil {
+			c.comparators = make(map[reflect.Type]reflect.Value)
+		}
+		c.comparators[t.In(0)] = f
+	}
+}
+
+// exported returns v, or if v was obtained through an unexported
+// field, an equivalent addressable Value that may be passed to a
+// function. It returns an invalid Value if there is none.
+func exported(v reflect.Value) reflect.Value {
+	switch {
+	case v.CanInterface():
+		return v
+	case v.CanAddr():
+		return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+	}
+	return reflect.Value{}
+}
+
+// floatEqual reports whether x and y, which are numbers
+// of the given size in bits, are equal under the options.
+func (c *config) floatEqual(x, y float64, bits int) bool {
+	switch {
+	case x == y:
+		return true
+	case math.IsNaN(x) || math.IsNaN(y):
+		return c.nanEqual && math.IsNaN(x) && math.IsNaN(y)
+	case c.epsilon > 0 && math.Abs(x-y) <= c.epsilon:
+		return true
+	case c.ulps > 0:
+		var xi, yi int64
+		if bits == 32 {
+			xi, yi = int64(ordered32(float32(x))), int64(ordered32(float32(y)))
+		} else {
+			xi, yi = ordered64(x), ordered64(y)
+		}
+		if xi < yi {
+			xi, yi = yi, xi
+		}
+		return uint64(xi)-uint64(yi) <= c.ulps
+	}
+	return false
+}
+
+// ordered64 maps the bits of f to an integer such that adjacent
+// representable numbers map to adjacent integers, and both zeros to 0.
+func ordered64(f float64) int64 {
+	i := int64(math.Float64bits(f))
+	if i < 0 {
+		i = math.MinInt64 - i
+	}
+	return i
+}
+
+// ordered32 is like ordered64, for float32.
+func ordered32(f float32) int32 {
+	i := int32(math.Float32bits(f))
+	if i < 0 {
+		i = math.MinInt32 - i
+	}
+	return i
+}
@@ -19,6 +19,8 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+
+	"gopl.io/ch7/eval"
 )
 
 type RenderingOptions struct {
@@ -86,8 +88,6 @@ func parseRenderingOptionsFromQuery(r *http.Request, def RenderingOptions) Rende
 }
 
 func webHandler(w http.ResponseWriter, r *http.Request) {
-	// Serve the fractals as PNG images
-	w.Header().Set("Content-Type", "image/png")
 	// Get the fractal from the query parameter
 	fractal := r.URL.Query().Get("fractal")
 	var fractalFunc func(complex128) color.Color
@@ -103,10 +103,60 @@ func webHandler(w http.ResponseWriter, r *http.Request) {
 	default:
 		fractalFunc = mandelbrot
 	}
+	// A user-written formula, if any, takes precedence
+	if formula := r.URL.Query().Get("formula"); formula != "" {
+		prog, err := parseFormula(formula)
+		if err != nil {
+			http.Error(w, "bad formula: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		fractalFunc = formulaFractal(prog)
+	}
+	// Serve the fractals as PNG images
+	w.Header().Set("Content-Type", "image/png")
 	opts := parseRenderingOptionsFromQuery(r, defaultOptions)
 	renderFractal(w, fractalFunc, opts)
 }
 
+// parseFormula parses an iteration formula in the variables z and c,
+// e.g., "z*z + c", which may also use i for the imaginary unit.
+func parseFormula(s string) (*eval.Program, error) {
+	prog, err := eval.ParseProgram(s)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[eval.Var]bool)
+	if err := prog.Check(vars); err != nil {
+		return nil, err
+	}
+	for v := range vars {
+		if v != "z" && v != "c" && v != eval.ImaginaryUnit {
+			return nil, fmt.Errorf("undefined variable: %s", v)
+		}
+	}
+	return prog, nil
+}
+
+// formulaFractal returns a fractal that iterates z = formula(z, c)
+// from z = 0 for each point c, coloring it as mandelbrot does.
+func formulaFractal(formula *eval.Program) func(complex128) color.Color {
+	return func(c complex128) color.Color {
+		const iterations = 200
+
+		env := make(map[eval.Var]complex128)
+		var z complex128
+		for n := 0; n < iterations; n++ {
+			env["z"], env["c"] = z, c
+			z = formula.EvalComplex(env)
+			if cmplx.Abs(z) > 2 || cmplx.IsNaN(z) {
+				hue := float64(n) / float64(iterations)
+				return hsvToRGB(hue, 1, 1)
+			}
+		}
+		return color.Black
+	}
+}
+
 func drawFractal(filename string, fractalFunc func(complex128) color.Color, opts RenderingOptions) {
 	handle, _ := os.Create(filename)
 	defer handle.Close() // Close the file when we're done
@@ -5,16 +5,24 @@
 //!+
 
 // Surface computes an SVG rendering of a 3-D surface function.
+//
+// The function is either one of the named presets or an arbitrary
+// expression in x, y and r = hypot(x, y), as accepted by gopl.io/ch7/eval.
 package main
 
 import (
 	"flag"
 	"fmt"
+	"image/color"
 	"io"
+	"log"
 	"math"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+
+	"gopl.io/ch7/eval"
 )
 
 type Point struct {
@@ -28,39 +36,55 @@ type Polygon struct {
 type RenderingOptions struct {
 	width, height, cells     int
 	xyrange, xyscale, zscale float64
-	angle                    float64
+	angle                    float64    // rotation about the z axis, in radians
+	low, high                color.RGBA // colors of the lowest and highest points
 }
 
 type UserOptions struct {
 	width, height, cells int
+	xyrange              float64    // x, y axis range (-xyrange/2..+xyrange/2)
+	zscale               float64    // pixels per z unit; zero means height * 0.4
+	angle                float64    // rotation about the z axis, in degrees
+	low, high            color.RGBA // colors of the lowest and highest points
 }
 
 func getRenderingOptions(opts UserOptions) RenderingOptions {
-	// Default rendering options
-	xyrange := 30.0
-	xyscale := float64(opts.width) / 2 / xyrange
-	zscale := float64(opts.height) * 0.4
+	xyscale := float64(opts.width) / 2 / opts.xyrange
+	zscale := opts.zscale
+	if zscale == 0 {
+		zscale = float64(opts.height) * 0.4
+	}
 	return RenderingOptions{
 		width:   opts.width,
 		height:  opts.height,
 		cells:   opts.cells,
-		xyrange: xyrange,
+		xyrange: opts.xyrange,
 		xyscale: xyscale,
 		zscale:  zscale,
+		angle:   opts.angle * math.Pi / 180,
+		low:     opts.low,
+		high:    opts.high,
 	}
 }
 
-var defaultOptions RenderingOptions
+var defaultUserOptions = UserOptions{
+	width:   600, // canvas size in pixels
+	height:  320,
+	cells:   100, // number of grid cells
+	xyrange: 30.0,
+	low:     color.RGBA{0x00, 0x00, 0xff, 0xff}, // blue valleys
+	high:    color.RGBA{0xff, 0x00, 0x00, 0xff}, // red peaks
+}
+
+var defaultOptions = getRenderingOptions(defaultUserOptions)
+
+// Limits on the options accepted by surfaceHandler. The work done and
+// the size of the response grow as cells squared.
+const (
+	maxCanvas = 4096 // pixels
+	maxCells  = 500
+)
 
-func init() {
-	width, height := 600, 320 // canvas size in pixels
-	cells := 100              // number of grid cells
-	defaultOptions = getRenderingOptions(UserOptions{
-		width:  width,
-		height: height,
-		cells:  cells,
-	})
-}                         // to protect currentOptions
 const rad30 = math.Pi / 6 // 30 degrees in radians
 
 var sin30, cos30 = math.Sin(rad30), math.Cos(rad30) // sin(30°), cos(30°)
@@ -76,10 +100,14 @@ func main() {
 	}
 	// If no web flag is set, run as a command line tool
 	// check whether there is a command line argument for the function to use
-	f := defaultSurface // default function
+	f, _ := getSurfaceFunction("") // default function
 	filename := "surface.svg"
 	if flag.NArg() > 0 {
-		f = getSurfaceFunction(flag.Arg(0))
+		var err error
+		f, err = getSurfaceFunction(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("surface: %v", err)
+		}
 	}
 	var out io.Writer
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
@@ -96,55 +124,131 @@ func main() {
 	renderSVG(out, f, defaultOptions)
 }
 
-func getSurfaceFunction(name string) func(x, y float64) float64 {
-	switch name {
-	case "eggbox":
-		return eggBox
-	case "saddle":
-		return saddle
-	case "moguls":
-		return moguls
-	default:
-		return defaultSurface // default function if no match
+// presets maps the names of some interesting surfaces to their expressions.
+var presets = map[string]string{
+	"default": "sin(r) / r",
+	"eggbox":  "sin(x) * cos(y)",
+	"saddle":  "(x*x - y*y) / 100",
+	"moguls":  "sin(x) * cos(y) / 2", // wavy bumps
+}
+
+// getSurfaceFunction returns the function described by s, which is
+// either the name of a preset or an expression in x, y and r.
+// An empty s denotes the default preset.
+func getSurfaceFunction(s string) (func(x, y float64) float64, error) {
+	if s == "" {
+		s = "default"
+	}
+	if expr, ok := presets[s]; ok {
+		s = expr
 	}
+	prog, err := eval.ParseProgram(s)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[eval.Var]bool)
+	if err := prog.Check(vars); err != nil {
+		return nil, err
+	}
+	for v := range vars {
+		if v != "x" && v != "y" && v != "r" {
+			return nil, fmt.Errorf("undefined variable: %s", v)
+		}
+	}
+	f, err := prog.Compile([]eval.Var{"x", "y", "r"})
+	if err != nil {
+		return nil, err
+	}
+	return func(x, y float64) float64 {
+		return f([]float64{x, y, math.Hypot(x, y)})
+	}, nil
 }
 
 func surfaceHandler(w http.ResponseWriter, r *http.Request) {
-	// Set the content type to SVG
-	w.Header().Set("Content-Type", "image/svg+xml")
-
-	// Get the surface type from the query parameter
-	surfaceType := r.URL.Query().Get("type")
-	userHeight := r.URL.Query().Get("height")
-	userWidth := r.URL.Query().Get("width")
-	userCells := r.URL.Query().Get("cells")
-	// some defaults
-	userOpts := UserOptions{
-		width:  defaultOptions.width,
-		height: defaultOptions.height,
-		cells:  defaultOptions.cells,
+	query := r.URL.Query()
+	// The function is given by an expression or, failing that, a preset name
+	expr := query.Get("expr")
+	if expr == "" {
+		expr = query.Get("type")
 	}
-	if userHeight != "" {
-		if height, err := strconv.Atoi(userHeight); err == nil {
-			userOpts.height = height
+	f, err := getSurfaceFunction(expr)
+	if err != nil {
+		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Options that are absent keep their defaults; any others must be
+	// well formed and within range.
+	userOpts := defaultUserOptions
+	var badParam error
+	getInt := func(key string, p *int, max int) {
+		s := query.Get(key)
+		if s == "" || badParam != nil {
+			return
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > max {
+			badParam = fmt.Errorf("%s must be an integer in 1..%d, got %q", key, max, s)
+			return
 		}
+		*p = v
 	}
-	if userWidth != "" {
-		if width, err := strconv.Atoi(userWidth); err == nil {
-			userOpts.width = width
+	getFloat := func(key string, p *float64, positive bool) {
+		s := query.Get(key)
+		if s == "" || badParam != nil {
+			return
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || positive && v <= 0 {
+			what := "a finite number"
+			if positive {
+				what = "a positive number"
+			}
+			badParam = fmt.Errorf("%s must be %s, got %q", key, what, s)
+			return
 		}
+		*p = v
 	}
-	if userCells != "" {
-		if cells, err := strconv.Atoi(userCells); err == nil {
-			userOpts.cells = cells
+	getColor := func(key string, p *color.RGBA) {
+		s := query.Get(key)
+		if s == "" || badParam != nil {
+			return
+		}
+		c, err := parseColor(s)
+		if err != nil {
+			badParam = fmt.Errorf("%s: %v", key, err)
+			return
 		}
+		*p = c
+	}
+	getInt("width", &userOpts.width, maxCanvas)
+	getInt("height", &userOpts.height, maxCanvas)
+	getInt("cells", &userOpts.cells, maxCells)
+	getFloat("xyrange", &userOpts.xyrange, true)
+	getFloat("zscale", &userOpts.zscale, true)
+	getFloat("angle", &userOpts.angle, false)
+	getColor("low", &userOpts.low)
+	getColor("high", &userOpts.high)
+	if badParam != nil {
+		http.Error(w, "bad parameter: "+badParam.Error(), http.StatusBadRequest)
+		return
 	}
 	userSurfaceOptions := getRenderingOptions(userOpts)
-	f := getSurfaceFunction(surfaceType)
+	// Set the content type to SVG
+	w.Header().Set("Content-Type", "image/svg+xml")
 	// Render the SVG directly to the response writer
 	renderSVG(w, f, userSurfaceOptions)
 }
 
+// parseColor parses a color of the form "rrggbb" or "#rrggbb".
+func parseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
+
 func renderSVG(out io.Writer, f func(x, y float64) float64, opts RenderingOptions) {
 	// Collect all valid polygons first
 	cells := opts.cells
@@ -182,7 +286,7 @@ func renderSVG(out io.Writer, f func(x, y float64) float64, opts RenderingOption
 	// Output polygons with color
 	for _, poly := range polygons {
 		avgZ := (poly.a.z + poly.b.z + poly.c.z + poly.d.z) / 4
-		color := colorForZ(avgZ, minZ, maxZ)
+		color := colorForZ(avgZ, minZ, maxZ, opts.low, opts.high)
 		fmt.Fprintf(out, "<polygon points='%g,%g %g,%g %g,%g %g,%g' fill='%s'/>\n",
 			poly.a.x, poly.a.y, poly.b.x, poly.b.y, poly.c.x, poly.c.y, poly.d.x, poly.d.y, color)
 	}
@@ -217,41 +321,28 @@ func corner(i, j int, f func(x, y float64) float64, opts RenderingOptions) Point
 		return Point{math.NaN(), math.NaN(), math.NaN()}
 	}
 
+	// Rotate (x,y) about the z axis.
+	sin, cos := math.Sin(opts.angle), math.Cos(opts.angle)
+	x, y = x*cos-y*sin, x*sin+y*cos
+
 	// Project (x,y,z) isometrically onto 2-D SVG canvas (sx,sy).
 	sx := width/2 + (x-y)*cos30*xyscale
 	sy := height/2 + (x+y)*sin30*xyscale - z*zscale
 	return Point{sx, sy, z}
 }
 
-func colorForZ(z, minZ, maxZ float64) string {
+// colorForZ returns the color of height z, graded from low at minZ
+// to high at maxZ.
+func colorForZ(z, minZ, maxZ float64, low, high color.RGBA) string {
 	if maxZ == minZ {
 		return "#888888"
 	}
 	t := (z - minZ) / (maxZ - minZ)
-	r := int(255 * t)
-	g := 0
-	b := int(255 * (1 - t))
-	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
-}
-
-func defaultSurface(x, y float64) float64 {
-	r := math.Hypot(x, y) // distance from (0,0)
-	return math.Sin(r) / r
-}
-
-func eggBox(x, y float64) float64 {
-	// Eggbox function: f(x,y) = sin(x) * cos(y)
-	return math.Sin(x) * math.Cos(y)
-}
-
-func saddle(x, y float64) float64 {
-	// Saddle function: f(x,y) = x^2 - y^2
-	return (x*x - y*y) / 100.0
-}
-
-func moguls(x, y float64) float64 {
-	// Moguls: wavy bumps using sine and cosine
-	return math.Sin(x) * math.Cos(y) / 2
+	mix := func(a, b uint8) int {
+		return int(float64(a) + t*(float64(b)-float64(a)))
+	}
+	return fmt.Sprintf("#%02x%02x%02x",
+		mix(low.R, high.R), mix(low.G, high.G), mix(low.B, high.B))
 }
 
 //!-
@@ -3,12 +3,27 @@
 
 package eval
 
+import "text/scanner"
+
 // An Expr is an arithmetic expression.
 type Expr interface {
 	// Eval returns the value of this Expr in the environment env.
 	Eval(env Env) float64
 	// Check reports errors in this Expr and adds its Vars to the set.
+	// It reports all errors, not just the first, as an ErrorList.
 	Check(vars map[Var]bool) error
+	// EvalInterval returns an interval containing every value of this
+	// Expr when each Var v ranges over env[v].
+	EvalInterval(env map[Var]Interval) Interval
+	// EvalComplex is like Eval, but for complex numbers.
+	EvalComplex(env map[Var]complex128) complex128
+
+	// eval, evalComplex and check are like Eval, EvalComplex and
+	// Check, but resolve function calls using fs before the
+	// registered functions.
+	eval(env Env, fs Funcs) float64
+	evalComplex(env map[Var]complex128, fs Funcs) complex128
+	check(vars map[Var]bool, fs Funcs) error
 }
 
 //!+ast
@@ -21,20 +36,57 @@ type literal float64
 
 // A unary represents a unary operator expression, e.g., -x.
 type unary struct {
-	op rune // one of '+', '-'
+	op rune // one of '+', '-', '!'
 	x  Expr
 }
 
 // A binary represents a binary operator expression, e.g., x+y.
 type binary struct {
-	op   rune // one of '+', '-', '*', '/'
+	op   rune // one of '+', '-', '*', '/', '<', '>', opLE, opGE, opEQ, opNE, opAnd, opOr
 	x, y Expr
 }
 
+// A conditional represents a ternary conditional expression, e.g., x < 0 ? -x : x.
+type conditional struct {
+	cond, x, y Expr
+}
+
 // A call represents a function call expression, e.g., sin(x).
 type call struct {
-	fn   string // one of "pow", "sin", "sqrt"
+	fn   string // name of a registered or supplied Func
 	args []Expr
+	pos  scanner.Position // position of fn in the input, if parsed
 }
 
 //!-ast
+
+// Operators spelled with two characters are represented by these
+// values, which lie outside the range of both runes and the
+// token values returned by text/scanner.
+const (
+	opLE  rune = -(iota + 100) // <=
+	opGE                       // >=
+	opEQ                       // ==
+	opNE                       // !=
+	opAnd                      // &&
+	opOr                       // ||
+)
+
+// opText returns the source spelling of the operator op.
+func opText(op rune) string {
+	switch op {
+	case opLE:
+		return "<="
+	case opGE:
+		return ">="
+	case opEQ:
+		return "=="
+	case opNE:
+		return "!="
+	case opAnd:
+		return "&&"
+	case opOr:
+		return "||"
+	}
+	return string(op)
+}
@@ -8,51 +8,71 @@ import (
 	"strings"
 )
 
+func (v Var) Check(vars map[Var]bool) error         { return v.check(vars, nil) }
+func (l literal) Check(vars map[Var]bool) error     { return l.check(vars, nil) }
+func (u unary) Check(vars map[Var]bool) error       { return u.check(vars, nil) }
+func (b binary) Check(vars map[Var]bool) error      { return b.check(vars, nil) }
+func (c conditional) Check(vars map[Var]bool) error { return c.check(vars, nil) }
+func (c call) Check(vars map[Var]bool) error        { return c.check(vars, nil) }
+
 //!+Check
 
-func (v Var) Check(vars map[Var]bool) error {
+func (v Var) check(vars map[Var]bool, fs Funcs) error {
 	vars[v] = true
 	return nil
 }
 
-func (literal) Check(vars map[Var]bool) error {
+func (literal) check(vars map[Var]bool, fs Funcs) error {
 	return nil
 }
 
-func (u unary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-", u.op) {
-		return fmt.Errorf("unexpected unary op %q", u.op)
+func (u unary) check(vars map[Var]bool, fs Funcs) error {
+	var errs ErrorList
+	if !strings.ContainsRune("+-!", u.op) {
+		errs.add(fmt.Errorf("unexpected unary op %q", u.op))
 	}
-	return u.x.Check(vars)
+	errs.add(u.x.check(vars, fs))
+	return errs.Err()
 }
 
-func (b binary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-*/", b.op) {
-		return fmt.Errorf("unexpected binary op %q", b.op)
-	}
-	if err := b.x.Check(vars); err != nil {
-		return err
+func (b binary) check(vars map[Var]bool, fs Funcs) error {
+	var errs ErrorList
+	if precedence(b.op) == 0 {
+		errs.add(fmt.Errorf("unexpected binary op '%s'", opText(b.op)))
 	}
-	return b.y.Check(vars)
+	errs.add(b.x.check(vars, fs))
+	errs.add(b.y.check(vars, fs))
+	return errs.Err()
 }
 
-func (c call) Check(vars map[Var]bool) error {
-	arity, ok := numParams[c.fn]
-	if !ok {
-		return fmt.Errorf("unknown function %q", c.fn)
-	}
-	if len(c.args) != arity {
-		return fmt.Errorf("call to %s has %d args, want %d",
-			c.fn, len(c.args), arity)
+func (c conditional) check(vars map[Var]bool, fs Funcs) error {
+	var errs ErrorList
+	errs.add(c.cond.check(vars, fs))
+	errs.add(c.x.check(vars, fs))
+	errs.add(c.y.check(vars, fs))
+	return errs.Err()
+}
+
+func (c call) check(vars map[Var]bool, fs Funcs) error {
+	var errs ErrorList
+	if f, ok := fs.lookup(c.fn); !ok {
+		errs.add(&Error{
+			Pos:   c.pos,
+			Token: c.fn,
+			Msg:   fmt.Sprintf("unknown function %q", c.fn),
+		})
+	} else if len(c.args) != f.Arity {
+		errs.add(&Error{
+			Pos:   c.pos,
+			Token: c.fn,
+			Msg: fmt.Sprintf("call to %s has %d args, want %d",
+				c.fn, len(c.args), f.Arity),
+		})
 	}
 	for _, arg := range c.args {
-		if err := arg.Check(vars); err != nil {
-			return err
-		}
+		errs.add(arg.check(vars, fs))
 	}
-	return nil
+	return errs.Err()
 }
 
-var numParams = map[string]int{"pow": 2, "sin": 1, "sqrt": 1}
-
 //!-Check
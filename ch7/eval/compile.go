@@ -0,0 +1,144 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import "fmt"
+
+// Compile translates e into a Go function for fast repeated evaluation.
+// The function's argument holds the values of vars, in order: args[i]
+// is the value of vars[i]. Unlike Eval, which treats an absent variable
+// as zero, Compile reports an error if e uses a variable not in vars.
+//
+// Function calls are resolved once, at compilation time, so later
+// calls to RegisterFunc do not affect the result.
+func Compile(e Expr, vars []Var) (func(args []float64) float64, error) {
+	return Funcs(nil).Compile(e, vars)
+}
+
+// Compile is like the Compile function, but resolves function calls using fs.
+func (fs Funcs) Compile(e Expr, vars []Var) (func(args []float64) float64, error) {
+	slots := make(map[Var]int)
+	for i, v := range vars {
+		if _, dup := slots[v]; dup {
+			return nil, fmt.Errorf("duplicate variable: %s", v)
+		}
+		slots[v] = i
+	}
+	return compile(e, slots, fs)
+}
+
+type compiled = func(args []float64) float64
+
+func compile(e Expr, slots map[Var]int, fs Funcs) (compiled, error) {
+	switch e := e.(type) {
+	case literal:
+		v := float64(e)
+		return func([]float64) float64 { return v }, nil
+
+	case Var:
+		i, ok := slots[e]
+		if !ok {
+			return nil, fmt.Errorf("undefined variable: %s", e)
+		}
+		return func(args []float64) float64 { return args[i] }, nil
+
+	case unary:
+		x, err := compile(e.x, slots, fs)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case '+':
+			return x, nil
+		case '-':
+			return func(args []float64) float64 { return -x(args) }, nil
+		case '!':
+			return func(args []float64) float64 { return truth(x(args) == 0) }, nil
+		}
+		return nil, fmt.Errorf("unexpected unary op %q", e.op)
+
+	case binary:
+		x, err := compile(e.x, slots, fs)
+		if err != nil {
+			return nil, err
+		}
+		y, err := compile(e.y, slots, fs)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case '+':
+			return func(args []float64) float64 { return x(args) + y(args) }, nil
+		case '-':
+			return func(args []float64) float64 { return x(args) - y(args) }, nil
+		case '*':
+			return func(args []float64) float64 { return x(args) * y(args) }, nil
+		case '/':
+			return func(args []float64) float64 { return x(args) / y(args) }, nil
+		case '<':
+			return func(args []float64) float64 { return truth(x(args) < y(args)) }, nil
+		case '>':
+			return func(args []float64) float64 { return truth(x(args) > y(args)) }, nil
+		case opLE:
+			return func(args []float64) float64 { return truth(x(args) <= y(args)) }, nil
+		case opGE:
+			return func(args []float64) float64 { return truth(x(args) >= y(args)) }, nil
+		case opEQ:
+			return func(args []float64) float64 { return truth(x(args) == y(args)) }, nil
+		case opNE:
+			return func(args []float64) float64 { return truth(x(args) != y(args)) }, nil
+		case opAnd:
+			return func(args []float64) float64 { return truth(x(args) != 0 && y(args) != 0) }, nil
+		case opOr:
+			return func(args []float64) float64 { return truth(x(args) != 0 || y(args) != 0) }, nil
+		}
+		return nil, fmt.Errorf("unexpected binary op '%s'", opText(e.op))
+
+	case conditional:
+		cond, err := compile(e.cond, slots, fs)
+		if err != nil {
+			return nil, err
+		}
+		x, err := compile(e.x, slots, fs)
+		if err != nil {
+			return nil, err
+		}
+		y, err := compile(e.y, slots, fs)
+		if err != nil {
+			return nil, err
+		}
+		return func(args []float64) float64 {
+			if cond(args) != 0 {
+				return x(args)
+			}
+			return y(args)
+		}, nil
+
+	case call:
+		f, ok := fs.lookup(e.fn)
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q", e.fn)
+		}
+		if len(e.args) != f.Arity {
+			return nil, fmt.Errorf("call to %s has %d args, want %d",
+				e.fn, len(e.args), f.Arity)
+		}
+		argfns := make([]compiled, len(e.args))
+		for i, arg := range e.args {
+			fn, err := compile(arg, slots, fs)
+			if err != nil {
+				return nil, err
+			}
+			argfns[i] = fn
+		}
+		return func(args []float64) float64 {
+			vals := make([]float64, len(argfns))
+			for i, fn := range argfns {
+				vals[i] = fn(args)
+			}
+			return f.Fn(vals...)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown Expr: %T", e)
+}
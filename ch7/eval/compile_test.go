@@ -0,0 +1,93 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	vars := []Var{"x", "y", "r"}
+	for _, input := range []string{
+		"sin(r) / r",
+		"pow(x, 3) + pow(y, 3)",
+		"-x + +y * 2 - 5 / 9",
+		"x < 0 ? -x : x",
+		"x >= y && !(r == 0) || x != y",
+		"x <= y ? hypot(x, y) : atan2(y, x)",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		f, err := Compile(expr, vars)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		for _, p := range [][2]float64{{-2, 3}, {1.5, 1.5}, {4, -0.5}, {0, 0}} {
+			x, y := p[0], p[1]
+			r := math.Hypot(x, y)
+			want := expr.Eval(Env{"x": x, "y": y, "r": r})
+			got := f([]float64{x, y, r})
+			if got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+				t.Errorf("%s at x=%g y=%g: compiled %g, Eval %g", input, x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr    string
+		vars    []Var
+		wantErr string
+	}{
+		{"x + z", []Var{"x"}, "undefined variable: z"},
+		{"x", []Var{"x", "x"}, "duplicate variable: x"},
+		{"erf(x)", []Var{"x"}, `unknown function "erf"`},
+		{"pow(x)", []Var{"x"}, "call to pow has 1 args, want 2"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+		_, err = Compile(expr, test.vars)
+		if err == nil || err.Error() != test.wantErr {
+			t.Errorf("Compile(%s, %v): got error %v, want %s",
+				test.expr, test.vars, err, test.wantErr)
+		}
+	}
+}
+
+const benchExpr = "sin(r) / r + pow(x, 2) * y - (x < y ? x : y)"
+
+func BenchmarkEval(b *testing.B) {
+	expr, err := Parse(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		x, y := float64(i%100), float64(i%37)
+		expr.Eval(Env{"x": x, "y": y, "r": math.Hypot(x, y)})
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	expr, err := Parse(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	f, err := Compile(expr, []Var{"x", "y", "r"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	args := make([]float64, 3)
+	for i := 0; i < b.N; i++ {
+		x, y := float64(i%100), float64(i%37)
+		args[0], args[1], args[2] = x, y, math.Hypot(x, y)
+		f(args)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// ImaginaryUnit is the variable that denotes √-1 in EvalComplex,
+// unless the environment gives it another value.
+const ImaginaryUnit Var = "i"
+
+func (v Var) EvalComplex(env map[Var]complex128) complex128         { return v.evalComplex(env, nil) }
+func (l literal) EvalComplex(env map[Var]complex128) complex128     { return l.evalComplex(env, nil) }
+func (u unary) EvalComplex(env map[Var]complex128) complex128       { return u.evalComplex(env, nil) }
+func (b binary) EvalComplex(env map[Var]complex128) complex128      { return b.evalComplex(env, nil) }
+func (c conditional) EvalComplex(env map[Var]complex128) complex128 { return c.evalComplex(env, nil) }
+func (c call) EvalComplex(env map[Var]complex128) complex128        { return c.evalComplex(env, nil) }
+
+func (v Var) evalComplex(env map[Var]complex128, _ Funcs) complex128 {
+	z, ok := env[v]
+	if !ok && v == ImaginaryUnit {
+		return 1i
+	}
+	return z
+}
+
+func (l literal) evalComplex(_ map[Var]complex128, _ Funcs) complex128 {
+	return complex(float64(l), 0)
+}
+
+func (u unary) evalComplex(env map[Var]complex128, fs Funcs) complex128 {
+	switch u.op {
+	case '+':
+		return +u.x.evalComplex(env, fs)
+	case '-':
+		// Subtract rather than negate so that -4 is -4+0i,
+		// not -4-0i, which lies on the other side of the
+		// branch cut of sqrt and log.
+		return 0 - u.x.evalComplex(env, fs)
+	case '!':
+		return complexTruth(u.x.evalComplex(env, fs) == 0)
+	}
+	panic("unsupported unary operator: " + opText(u.op))
+}
+
+// The ordering operators compare only the real parts of their
+// operands; == and != compare both parts.
+func (b binary) evalComplex(env map[Var]complex128, fs Funcs) complex128 {
+	switch b.op {
+	case opAnd:
+		return complexTruth(b.x.evalComplex(env, fs) != 0 && b.y.evalComplex(env, fs) != 0)
+	case opOr:
+		return complexTruth(b.x.evalComplex(env, fs) != 0 || b.y.evalComplex(env, fs) != 0)
+	}
+	x, y := b.x.evalComplex(env, fs), b.y.evalComplex(env, fs)
+	switch b.op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	case '/':
+		return x / y
+	case '<':
+		return complexTruth(real(x) < real(y))
+	case '>':
+		return complexTruth(real(x) > real(y))
+	case opLE:
+		return complexTruth(real(x) <= real(y))
+	case opGE:
+		return complexTruth(real(x) >= real(y))
+	case opEQ:
+		return complexTruth(x == y)
+	case opNE:
+		return complexTruth(x != y)
+	}
+	panic("unsupported binary operator: " + opText(b.op))
+}
+
+func (c conditional) evalComplex(env map[Var]complex128, fs Funcs) complex128 {
+	if c.cond.evalComplex(env, fs) != 0 {
+		return c.x.evalComplex(env, fs)
+	}
+	return c.y.evalComplex(env, fs)
+}
+
+// A call to a registered or supplied function, which has no complex
+// version, yields NaN unless all its arguments are real.
+func (c call) evalComplex(env map[Var]complex128, fs Funcs) complex128 {
+	args := make([]complex128, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.evalComplex(env, fs)
+	}
+	if _, replaced := fs[c.fn]; !replaced {
+		if f, ok := stdComplex[c.fn]; ok && len(args) == std[c.fn].Arity {
+			return f(args)
+		}
+	}
+	f, ok := fs.lookup(c.fn)
+	if !ok {
+		panic("unsupported function call: " + c.fn)
+	}
+	reals := make([]float64, len(args))
+	for i, z := range args {
+		if imag(z) != 0 {
+			return cmplx.NaN()
+		}
+		reals[i] = real(z)
+	}
+	return complex(f.Fn(reals...), 0)
+}
+
+// EvalComplex is like Eval, but for complex numbers.
+func (p *Program) EvalComplex(env map[Var]complex128) complex128 {
+	if env == nil {
+		env = make(map[Var]complex128)
+	}
+	for _, s := range p.stmts {
+		env[s.v] = s.x.evalComplex(env, nil)
+	}
+	return p.result.evalComplex(env, nil)
+}
+
+func complexTruth(b bool) complex128 { return complex(truth(b), 0) }
+
+// stdComplex holds complex versions of the standard functions.
+// Those without a natural complex extension (atan2, min, max)
+// act on the real parts of their arguments; floor and ceil act
+// on each part separately.
+var stdComplex = map[string]func(args []complex128) complex128{
+	"pow":   func(a []complex128) complex128 { return cmplx.Pow(a[0], a[1]) },
+	"sin":   func(a []complex128) complex128 { return cmplx.Sin(a[0]) },
+	"cos":   func(a []complex128) complex128 { return cmplx.Cos(a[0]) },
+	"tan":   func(a []complex128) complex128 { return cmplx.Tan(a[0]) },
+	"sqrt":  func(a []complex128) complex128 { return cmplx.Sqrt(a[0]) },
+	"log":   func(a []complex128) complex128 { return cmplx.Log(a[0]) },
+	"exp":   func(a []complex128) complex128 { return cmplx.Exp(a[0]) },
+	"abs":   func(a []complex128) complex128 { return complex(cmplx.Abs(a[0]), 0) },
+	"hypot": func(a []complex128) complex128 { return cmplx.Sqrt(a[0]*a[0] + a[1]*a[1]) },
+	"floor": func(a []complex128) complex128 {
+		return complex(math.Floor(real(a[0])), math.Floor(imag(a[0])))
+	},
+	"ceil": func(a []complex128) complex128 {
+		return complex(math.Ceil(real(a[0])), math.Ceil(imag(a[0])))
+	},
+	"atan2": func(a []complex128) complex128 {
+		return complex(math.Atan2(real(a[0]), real(a[1])), 0)
+	},
+	"min": func(a []complex128) complex128 {
+		if real(a[1]) < real(a[0]) {
+			return a[1]
+		}
+		return a[0]
+	},
+	"max": func(a []complex128) complex128 {
+		if real(a[1]) > real(a[0]) {
+			return a[1]
+		}
+		return a[0]
+	},
+}
@@ -0,0 +1,89 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestEvalComplex(t *testing.T) {
+	fs := Funcs{"half": {1, func(a ...float64) float64 { return a[0] / 2 }}}
+	nan := cmplx.NaN()
+	for _, test := range []struct {
+		expr string
+		env  map[Var]complex128
+		want complex128
+	}{
+		{"i * i", nil, -1},
+		{"z * z + c", map[Var]complex128{"z": 1 + 1i, "c": -1}, -1 + 2i},
+		{"1 / i", nil, -1i},
+		{"exp(i * pi) + 1", map[Var]complex128{"pi": math.Pi}, 0},
+		{"sqrt(-4)", nil, 2i},
+		{"abs(3 + 4 * i)", nil, 5},
+		{"pow(i, 2)", nil, -1},
+		{"floor(1.5 + 2.5 * i)", nil, 1 + 2i},
+		{"z == 2 * i ? 1 : 0", map[Var]complex128{"z": 2i}, 1},
+		{"z > 1 && !(z == 0)", map[Var]complex128{"z": 2 - 5i}, 1},
+		{"i", map[Var]complex128{"i": 3}, 3},
+		{"half(z)", map[Var]complex128{"z": 3}, 1.5},
+		{"half(z)", map[Var]complex128{"z": 3i}, nan},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got := fs.EvalComplex(expr, test.env)
+		if !closeComplex(got, test.want) {
+			t.Errorf("%s.EvalComplex(%v) = %v, want %v", test.expr, test.env, got, test.want)
+		}
+	}
+
+	// Without the table, half is unknown.
+	expr, err := Parse("half(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("EvalComplex of unknown function did not panic")
+			}
+		}()
+		expr.EvalComplex(nil)
+	}()
+}
+
+// closeComplex reports whether x and y agree to within a small
+// absolute error in each part, or are both NaN.
+func closeComplex(x, y complex128) bool {
+	if cmplx.IsNaN(x) || cmplx.IsNaN(y) {
+		return cmplx.IsNaN(x) && cmplx.IsNaN(y)
+	}
+	const eps = 1e-12
+	return math.Abs(real(x)-real(y)) <= eps && math.Abs(imag(x)-imag(y)) <= eps
+}
+
+func TestEvalComplexAgreesWithEval(t *testing.T) {
+	env := Env{"x": 0.7, "y": 2.5}
+	cenv := map[Var]complex128{"x": 0.7, "y": 2.5}
+	for _, input := range []string{
+		"sin(x) * cos(y) / tan(x)",
+		"pow(y, x) + log(y) - exp(x)",
+		"hypot(x, y) + atan2(y, x) + min(x, y) - max(x, y)",
+		"x < y ? sqrt(y) : -1",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		want := expr.Eval(env)
+		got := expr.EvalComplex(cenv)
+		if math.Abs(real(got)-want) > 1e-12 || math.Abs(imag(got)) > 1e-12 {
+			t.Errorf("%s: EvalComplex = %v, Eval = %g", input, got, want)
+		}
+	}
+}
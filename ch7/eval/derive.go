@@ -0,0 +1,149 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import "fmt"
+
+// Derive returns the simplified symbolic derivative of e with respect to v.
+//
+// Comparison and logical operators are treated as piecewise constant,
+// so their derivative is zero; a conditional is differentiated branchwise.
+// Derive reports an error for calls to functions other than the standard ones.
+func Derive(e Expr, v Var) (Expr, error) {
+	d, err := derive(e, v)
+	if err != nil {
+		return nil, err
+	}
+	return Simplify(d), nil
+}
+
+func derive(e Expr, v Var) (Expr, error) {
+	switch e := e.(type) {
+	case literal:
+		return literal(0), nil
+
+	case Var:
+		if e == v {
+			return literal(1), nil
+		}
+		return literal(0), nil
+
+	case unary:
+		if e.op == '!' {
+			return literal(0), nil
+		}
+		dx, err := derive(e.x, v)
+		if err != nil {
+			return nil, err
+		}
+		return unary{e.op, dx}, nil
+
+	case binary:
+		if precedence(e.op) < precedence('+') {
+			return literal(0), nil // comparison or logical operator
+		}
+		dx, err := derive(e.x, v)
+		if err != nil {
+			return nil, err
+		}
+		dy, err := derive(e.y, v)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case '+', '-':
+			return binary{e.op, dx, dy}, nil
+		case '*':
+			// (xy)' = x'y + xy'
+			return binary{'+', binary{'*', dx, e.y}, binary{'*', e.x, dy}}, nil
+		case '/':
+			// (x/y)' = (x'y - xy') / y²
+			return binary{'/',
+				binary{'-', binary{'*', dx, e.y}, binary{'*', e.x, dy}},
+				binary{'*', e.y, e.y}}, nil
+		}
+		return nil, fmt.Errorf("unexpected binary op '%s'", opText(e.op))
+
+	case conditional:
+		dx, err := derive(e.x, v)
+		if err != nil {
+			return nil, err
+		}
+		dy, err := derive(e.y, v)
+		if err != nil {
+			return nil, err
+		}
+		return conditional{e.cond, dx, dy}, nil
+
+	case call:
+		return deriveCall(e, v)
+	}
+	return nil, fmt.Errorf("unknown Expr: %T", e)
+}
+
+// deriveCall applies the chain rule to a call of a standard function.
+func deriveCall(c call, v Var) (Expr, error) {
+	f, ok := std[c.fn]
+	if !ok {
+		return nil, fmt.Errorf("cannot differentiate function %q", c.fn)
+	}
+	if len(c.args) != f.Arity {
+		return nil, fmt.Errorf("call to %s has %d args, want %d",
+			c.fn, len(c.args), f.Arity)
+	}
+	d := make([]Expr, len(c.args))
+	for i, arg := range c.args {
+		di, err := derive(arg, v)
+		if err != nil {
+			return nil, err
+		}
+		d[i] = di
+	}
+	mul := func(x, y Expr) Expr { return binary{'*', x, y} }
+	div := func(x, y Expr) Expr { return binary{'/', x, y} }
+	add := func(x, y Expr) Expr { return binary{'+', x, y} }
+	sub := func(x, y Expr) Expr { return binary{'-', x, y} }
+
+	u, du := c.args[0], d[0]
+	switch c.fn {
+	case "sin":
+		return mul(call{fn: "cos", args: []Expr{u}}, du), nil
+	case "cos":
+		return mul(unary{'-', call{fn: "sin", args: []Expr{u}}}, du), nil
+	case "tan":
+		cos := call{fn: "cos", args: []Expr{u}}
+		return div(du, mul(cos, cos)), nil
+	case "sqrt":
+		return div(du, mul(literal(2), c)), nil
+	case "log":
+		return div(du, u), nil
+	case "exp":
+		return mul(c, du), nil
+	case "abs":
+		return mul(div(u, c), du), nil
+	case "floor", "ceil":
+		return literal(0), nil
+	case "pow":
+		w, dw := c.args[1], d[1]
+		if isLiteral(Simplify(dw), 0) {
+			// (u^w)' = w u^(w-1) u', for w independent of v
+			return mul(mul(w, call{fn: "pow", args: []Expr{u, sub(w, literal(1))}}), du), nil
+		}
+		// (u^w)' = u^w (w' log(u) + w u'/u)
+		return mul(c, add(mul(dw, call{fn: "log", args: []Expr{u}}), div(mul(w, du), u))), nil
+	case "atan2":
+		// atan2(y, x)' = (x y' - y x') / (x² + y²)
+		y, dy, x, dx := c.args[0], d[0], c.args[1], d[1]
+		return div(sub(mul(x, dy), mul(y, dx)), add(mul(x, x), mul(y, y))), nil
+	case "hypot":
+		// hypot(a, b)' = (a a' + b b') / hypot(a, b)
+		a, da, b, db := c.args[0], d[0], c.args[1], d[1]
+		return div(add(mul(a, da), mul(b, db)), c), nil
+	case "min":
+		return conditional{binary{'<', c.args[0], c.args[1]}, d[0], d[1]}, nil
+	case "max":
+		return conditional{binary{'>', c.args[0], c.args[1]}, d[0], d[1]}, nil
+	}
+	return nil, fmt.Errorf("cannot differentiate function %q", c.fn)
+}
@@ -0,0 +1,118 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"3", "0"},
+		{"y", "0"},
+		{"x", "1"},
+		{"2 * x + 1", "2"},
+		{"x * x", "(x + x)"},
+		{"pow(x, 4) - 1", "(4 * pow(x, 3))"},
+		{"sin(x)", "cos(x)"},
+		{"-cos(2 * x)", "(sin((2 * x)) * 2)"},
+		{"sqrt(x)", "(1 / (2 * sqrt(x)))"},
+		{"log(x) + y", "(1 / x)"},
+		{"x < 0 ? -x : x", "((x < 0) ? -1 : 1)"},
+		{"floor(x) + (x > y)", "0"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		d, err := Derive(expr, "x")
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(d); got != test.want {
+			t.Errorf("Derive(%s, x) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+// TestDeriveNumeric compares derivatives against central differences.
+func TestDeriveNumeric(t *testing.T) {
+	for _, input := range []string{
+		"x * sin(x) / (1 + x * x)",
+		"tan(x) + exp(-x) - abs(x - 3)",
+		"pow(x, y) + pow(2, x)",
+		"atan2(x, y) * hypot(x, y)",
+		"min(x, y) + max(x * x, y)",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		d, err := Derive(expr, "x")
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		const h = 1e-6
+		for _, x := range []float64{0.3, 1.1, 2.7} {
+			env := Env{"y": 1.9}
+			env["x"] = x + h
+			hi := expr.Eval(env)
+			env["x"] = x - h
+			lo := expr.Eval(env)
+			want := (hi - lo) / (2 * h)
+			env["x"] = x
+			got := d.Eval(env)
+			if math.Abs(got-want) > 1e-4*math.Max(1, math.Abs(want)) {
+				t.Errorf("%s: d/dx at x=%g is %g, want %g (derivative %s)",
+					input, x, got, want, Format(d))
+			}
+		}
+	}
+}
+
+func TestDeriveErrors(t *testing.T) {
+	fs := Funcs{"sinc": {1, func(a ...float64) float64 { return math.Sin(a[0]) / a[0] }}}
+	expr, err := Parse("sinc(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Check(expr, map[Var]bool{"x": true}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Derive(expr, "x")
+	if want := `cannot differentiate function "sinc"`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"x + 0", "x"},
+		{"0 + x * 1", "x"},
+		{"1 * x - 0", "x"},
+		{"0 - x", "(-x)"},
+		{"--x", "x"},
+		{"x * 0 + y", "y"},
+		{"x / 1", "x"},
+		{"2 * 3 + x", "(6 + x)"},
+		{"pow(x, 2 - 1)", "x"},
+		{"sqrt(16) * x", "(4 * x)"},
+		{"1 < 2 ? x : y", "x"},
+		{"-(2)", "-2"},
+		{"-x * -y", "(x * y)"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(Simplify(expr)); got != test.want {
+			t.Errorf("Simplify(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"text/scanner"
+)
+
+// An Error describes a problem found by Parse or Check.
+//
+// The Error method returns only the message; the position
+// and tokens are available for tools that wish to
+// highlight the problem within the input.
+type Error struct {
+	Pos      scanner.Position // start of offending token; Line is 0 if unknown
+	Token    string           // offending token, if any, e.g. "%" or "sqrt"
+	Expected []string         // tokens acceptable in place of Token, if known
+	Msg      string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+// An ErrorList is a list of *Errors, in the order found.
+// The zero value is an empty list ready to use.
+type ErrorList []*Error
+
+// add appends err to the list. If err is itself an ErrorList,
+// its elements are appended; any other non-nil error is
+// appended as an Error without position.
+func (p *ErrorList) add(err error) {
+	switch err := err.(type) {
+	case nil:
+		// no error
+	case *Error:
+		*p = append(*p, err)
+	case ErrorList:
+		*p = append(*p, err...)
+	default:
+		*p = append(*p, &Error{Msg: err.Error()})
+	}
+}
+
+// Err returns an error equivalent to this list,
+// or nil if the list is empty.
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
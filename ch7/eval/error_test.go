@@ -0,0 +1,69 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		pos      string // line:column
+		token    string
+		expected []string
+	}{
+		{"x % 2", "1:3", "%", []string{"operator", "end of file"}},
+		{"1 +\n  * 2", "2:3", "*", []string{"identifier", "number", "(", "+", "-", "!"}},
+		{"pow(x, 2", "1:9", "", []string{",", ")"}},
+		{"(x + 1", "1:7", "", []string{")"}},
+		{"x ? y z", "1:7", "z", []string{":"}},
+		{"a <= <= b", "1:6", "<=", []string{"identifier", "number", "(", "+", "-", "!"}},
+	} {
+		_, err := Parse(test.input)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Parse(%q) returned %T (%v), want *Error", test.input, err, err)
+			continue
+		}
+		if pos := fmt.Sprintf("%d:%d", e.Pos.Line, e.Pos.Column); pos != test.pos {
+			t.Errorf("Parse(%q): error at %s, want %s", test.input, pos, test.pos)
+		}
+		if e.Token != test.token {
+			t.Errorf("Parse(%q): Token = %q, want %q", test.input, e.Token, test.token)
+		}
+		if !reflect.DeepEqual(e.Expected, test.expected) {
+			t.Errorf("Parse(%q): Expected = %q, want %q", test.input, e.Expected, test.expected)
+		}
+	}
+}
+
+func TestCheckErrorList(t *testing.T) {
+	expr, err := Parse("erf(x) + sqrt(1, 2) *\n    pow(nosuch(y), 3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = expr.Check(map[Var]bool{})
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Check returned %T (%v), want ErrorList", err, err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, fmt.Sprintf("%d:%d %s: %s", e.Pos.Line, e.Pos.Column, e.Token, e.Msg))
+	}
+	want := []string{
+		`1:1 erf: unknown function "erf"`,
+		`1:10 sqrt: call to sqrt has 2 args, want 1`,
+		`2:9 nosuch: unknown function "nosuch"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check errors:\ngot  %q\nwant %q", got, want)
+	}
+	if want := `unknown function "erf" (and 2 more errors)`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
@@ -8,7 +8,6 @@ package eval
 
 import (
 	"fmt"
-	"math"
 )
 
 //!+env
@@ -17,13 +16,20 @@ type Env map[Var]float64
 
 //!-env
 
+func (v Var) Eval(env Env) float64         { return v.eval(env, nil) }
+func (l literal) Eval(env Env) float64     { return l.eval(env, nil) }
+func (u unary) Eval(env Env) float64       { return u.eval(env, nil) }
+func (b binary) Eval(env Env) float64      { return b.eval(env, nil) }
+func (c conditional) Eval(env Env) float64 { return c.eval(env, nil) }
+func (c call) Eval(env Env) float64        { return c.eval(env, nil) }
+
 //!+Eval1
 
-func (v Var) Eval(env Env) float64 {
+func (v Var) eval(env Env, _ Funcs) float64 {
 	return env[v]
 }
 
-func (l literal) Eval(_ Env) float64 {
+func (l literal) eval(_ Env, _ Funcs) float64 {
 	return float64(l)
 }
 
@@ -31,40 +37,75 @@ func (l literal) Eval(_ Env) float64 {
 
 //!+Eval2
 
-func (u unary) Eval(env Env) float64 {
+func (u unary) eval(env Env, fs Funcs) float64 {
 	switch u.op {
 	case '+':
-		return +u.x.Eval(env)
+		return +u.x.eval(env, fs)
 	case '-':
-		return -u.x.Eval(env)
+		return -u.x.eval(env, fs)
+	case '!':
+		return truth(u.x.eval(env, fs) == 0)
 	}
 	panic(fmt.Sprintf("unsupported unary operator: %q", u.op))
 }
 
-func (b binary) Eval(env Env) float64 {
+func (b binary) eval(env Env, fs Funcs) float64 {
 	switch b.op {
 	case '+':
-		return b.x.Eval(env) + b.y.Eval(env)
+		return b.x.eval(env, fs) + b.y.eval(env, fs)
 	case '-':
-		return b.x.Eval(env) - b.y.Eval(env)
+		return b.x.eval(env, fs) - b.y.eval(env, fs)
 	case '*':
-		return b.x.Eval(env) * b.y.Eval(env)
+		return b.x.eval(env, fs) * b.y.eval(env, fs)
 	case '/':
-		return b.x.Eval(env) / b.y.Eval(env)
+		return b.x.eval(env, fs) / b.y.eval(env, fs)
+	case '<':
+		return truth(b.x.eval(env, fs) < b.y.eval(env, fs))
+	case '>':
+		return truth(b.x.eval(env, fs) > b.y.eval(env, fs))
+	case opLE:
+		return truth(b.x.eval(env, fs) <= b.y.eval(env, fs))
+	case opGE:
+		return truth(b.x.eval(env, fs) >= b.y.eval(env, fs))
+	case opEQ:
+		return truth(b.x.eval(env, fs) == b.y.eval(env, fs))
+	case opNE:
+		return truth(b.x.eval(env, fs) != b.y.eval(env, fs))
+	case opAnd:
+		return truth(b.x.eval(env, fs) != 0 && b.y.eval(env, fs) != 0)
+	case opOr:
+		return truth(b.x.eval(env, fs) != 0 || b.y.eval(env, fs) != 0)
+	}
+	panic(fmt.Sprintf("unsupported binary operator: '%s'", opText(b.op)))
+}
+
+func (c conditional) eval(env Env, fs Funcs) float64 {
+	if c.cond.eval(env, fs) != 0 {
+		return c.x.eval(env, fs)
 	}
-	panic(fmt.Sprintf("unsupported binary operator: %q", b.op))
+	return c.y.eval(env, fs)
 }
 
-func (c call) Eval(env Env) float64 {
-	switch c.fn {
-	case "pow":
-		return math.Pow(c.args[0].Eval(env), c.args[1].Eval(env))
-	case "sin":
-		return math.Sin(c.args[0].Eval(env))
-	case "sqrt":
-		return math.Sqrt(c.args[0].Eval(env))
+func (c call) eval(env Env, fs Funcs) float64 {
+	f, ok := fs.lookup(c.fn)
+	if !ok {
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn))
 	}
-	panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.eval(env, fs)
+	}
+	return f.Fn(args...)
 }
 
 //!-Eval2
+
+// truth converts a boolean to the numeric truth values
+// yielded by the comparison and logical operators:
+// 1 for true and 0 for false.
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -26,6 +26,17 @@ func TestEval(t *testing.T) {
 		// additional tests that don't appear in the book
 		{"-1 + -x", Env{"x": 1}, "-2"},
 		{"-1 - x", Env{"x": 1}, "-2"},
+		{"x < 0 ? -x : x", Env{"x": -3}, "3"},
+		{"x < 0 ? -x : x", Env{"x": 3}, "3"},
+		{"a >= b && c != d", Env{"a": 2, "b": 1, "c": 1, "d": 2}, "1"},
+		{"a >= b && c != d", Env{"a": 2, "b": 1, "c": 1, "d": 1}, "0"},
+		{"a <= b || c == d", Env{"a": 2, "b": 1, "c": 1, "d": 1}, "1"},
+		{"!flag", Env{"flag": 0}, "1"},
+		{"!flag", Env{"flag": 2}, "0"},
+		{"1 + 2 > 2 == 1", nil, "1"},
+		{"x > 0 ? 1 : x < 0 ? -1 : 0", Env{"x": -5}, "-1"},
+		{"x > 0 ? 1 : x < 0 ? -1 : 0", Env{"x": 0}, "0"},
+		{"x == 0 ? 0 : 1 / x", Env{"x": 0}, "0"},
 		//!+Eval
 	}
 	var prevExpr string
@@ -79,9 +90,12 @@ func TestErrors(t *testing.T) {
 	for _, test := range []struct{ expr, wantErr string }{
 		{"x % 2", "unexpected '%'"},
 		{"math.Pi", "unexpected '.'"},
-		{"!true", "unexpected '!'"},
+		{"x = 1", "unexpected '='"},
+		{"x & y", "unexpected '&'"},
+		{"x ? y", "got end of file, want ':'"},
+		{"x <= ", "unexpected end of file"},
 		{`"hello"`, "unexpected '\"'"},
-		{"log(10)", `unknown function "log"`},
+		{"erf(10)", `unknown function "erf"`},
 		{"sqrt(1, 2)", "call to sqrt has 2 args, want 1"},
 	} {
 		expr, err := Parse(test.expr)
@@ -104,10 +118,149 @@ func TestErrors(t *testing.T) {
 //!+errors
 x % 2               unexpected '%'
 math.Pi             unexpected '.'
-!true               unexpected '!'
 "hello"             unexpected '"'
 
-log(10)             unknown function "log"
+erf(10)             unknown function "erf"
 sqrt(1, 2)          call to sqrt has 2 args, want 1
 //!-errors
 */
+
+func TestFormatOperators(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"!x", "(!x)"},
+		{"a < b && c >= d", "((a < b) && (c >= d))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a == b != c", "((a == b) != c)"},
+		{"x < 0 ? -x : x", "((x < 0) ? (-x) : x)"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(expr); got != test.want {
+			t.Errorf("Format(%s) = %s, want %s", test.expr, got, test.want)
+		}
+		if err := expr.Check(map[Var]bool{}); err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+		}
+	}
+}
+
+func TestStandardFuncs(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{"log(exp(2))", "2"},
+		{"cos(0) + tan(0)", "1"},
+		{"atan2(1, 1) * 4", "3.14159"},
+		{"min(3, 4) + max(3, 4)", "7"},
+		{"abs(-2.5)", "2.5"},
+		{"floor(2.5) + ceil(2.5)", "5"},
+		{"hypot(3, 4)", "5"},
+	} {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := fmt.Sprintf("%.6g", expr.Eval(nil)); got != test.want {
+			t.Errorf("%s = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	clamp := func(a ...float64) float64 { return math.Max(a[1], math.Min(a[0], a[2])) }
+	fs := Funcs{"clamp": {3, clamp}}
+	expr, err := Parse("clamp(x, 0, 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Check(expr, map[Var]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Eval(expr, Env{"x": 7}); got != 1 {
+		t.Errorf("clamp(7, 0, 1) = %g, want 1", got)
+	}
+
+	// Check validates arity against the table.
+	expr, err = Parse("clamp(x, 0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fs.Check(expr, map[Var]bool{})
+	if want := "call to clamp has 2 args, want 3"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+
+	// Registration affects every expression, so
+	// register into a fresh registry for this test only.
+	defer func(saved Funcs) { registry = saved }(registry)
+	registry = make(Funcs)
+	RegisterFunc("clamp", 3, clamp)
+	expr, err = Parse("clamp(x, 0, 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.Eval(Env{"x": -7}); got != 0 {
+		t.Errorf("clamp(-7, 0, 1) = %g, want 0", got)
+	}
+	for _, name := range []string{"clamp", "sin"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("duplicate RegisterFunc(%q) did not panic", name)
+				}
+			}()
+			RegisterFunc(name, 1, func(a ...float64) float64 { return 0 })
+		}()
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	var calls int
+	fs := Funcs{
+		// double is new; sin replaces the registered sin.
+		"double": {1, func(a ...float64) float64 { calls++; return 2 * a[0] }},
+		"sin":    {1, func(a ...float64) float64 { calls++; return 42 }},
+	}
+	expr, err := Parse("double(sin(x)) + sqrt(4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err == nil {
+		t.Errorf("Check of %s without table succeeded", Format(expr))
+	}
+	if err := fs.Check(expr, map[Var]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Eval(expr, Env{"x": 1}); got != 86 {
+		t.Errorf("Eval = %g, want 86", got)
+	}
+
+	// Logical operators and conditionals evaluate only what they need.
+	calls = 0
+	for _, input := range []string{
+		"0 && double(1)",
+		"1 || double(1)",
+		"1 ? 0 : double(1)",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs.Eval(expr, nil)
+	}
+	if calls != 0 {
+		t.Errorf("%d calls made, want 0", calls)
+	}
+}
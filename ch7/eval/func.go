@@ -0,0 +1,83 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// A Func is a function that an expression may call by name.
+type Func struct {
+	Arity int // number of arguments
+	Fn    func(args ...float64) float64
+}
+
+// Funcs is a table of functions, indexed by name,
+// for use in a single evaluation.
+//
+// Calls are resolved first in the table, then among
+// the registered functions, so a table may both add
+// functions and replace registered ones.
+type Funcs map[string]Func
+
+// Eval returns the value of e in the environment env,
+// resolving function calls using fs.
+func (fs Funcs) Eval(e Expr, env Env) float64 { return e.eval(env, fs) }
+
+// EvalComplex is like e.EvalComplex, but resolves function calls using fs.
+func (fs Funcs) EvalComplex(e Expr, env map[Var]complex128) complex128 {
+	return e.evalComplex(env, fs)
+}
+
+// Check is like e.Check, but resolves function calls using fs.
+func (fs Funcs) Check(e Expr, vars map[Var]bool) error { return e.check(vars, fs) }
+
+func (fs Funcs) lookup(name string) (Func, bool) {
+	if f, ok := fs[name]; ok {
+		return f, true
+	}
+	if f, ok := std[name]; ok {
+		return f, true
+	}
+	f, ok := registry[name]
+	return f, ok
+}
+
+// std holds the standard functions, available to every expression.
+// They are pure, so Simplify may fold calls with constant arguments.
+var std = Funcs{
+	"pow":   {2, func(a ...float64) float64 { return math.Pow(a[0], a[1]) }},
+	"sin":   {1, func(a ...float64) float64 { return math.Sin(a[0]) }},
+	"sqrt":  {1, func(a ...float64) float64 { return math.Sqrt(a[0]) }},
+	"log":   {1, func(a ...float64) float64 { return math.Log(a[0]) }},
+	"exp":   {1, func(a ...float64) float64 { return math.Exp(a[0]) }},
+	"cos":   {1, func(a ...float64) float64 { return math.Cos(a[0]) }},
+	"tan":   {1, func(a ...float64) float64 { return math.Tan(a[0]) }},
+	"atan2": {2, func(a ...float64) float64 { return math.Atan2(a[0], a[1]) }},
+	"min":   {2, func(a ...float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a ...float64) float64 { return math.Max(a[0], a[1]) }},
+	"abs":   {1, func(a ...float64) float64 { return math.Abs(a[0]) }},
+	"floor": {1, func(a ...float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a ...float64) float64 { return math.Ceil(a[0]) }},
+	"hypot": {2, func(a ...float64) float64 { return math.Hypot(a[0], a[1]) }},
+}
+
+// registry holds the functions added by RegisterFunc.
+var registry = make(Funcs)
+
+// RegisterFunc makes fn available to all expressions under the given
+// name. It panics if fn is nil or the name is already registered.
+//
+// RegisterFunc is not safe to call concurrently with Check or Eval;
+// it is intended to be called from an init function.
+func RegisterFunc(name string, arity int, fn func(args ...float64) float64) {
+	if fn == nil {
+		panic("eval: RegisterFunc of nil func " + name)
+	}
+	if _, dup := Funcs(nil).lookup(name); dup {
+		panic(fmt.Sprintf("eval: RegisterFunc called twice for %s", name))
+	}
+	registry[name] = Func{arity, fn}
+}
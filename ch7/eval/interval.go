@@ -0,0 +1,379 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import "math"
+
+// An Interval is the closed range of real numbers [Lo, Hi].
+//
+// An Interval with Lo > Hi is empty. Applying a function to
+// arguments wholly outside its domain, e.g., sqrt([-2, -1]),
+// yields an empty Interval.
+type Interval struct {
+	Lo, Hi float64
+}
+
+// Point returns the interval [x, x].
+func Point(x float64) Interval { return Interval{x, x} }
+
+var (
+	empty  = Interval{math.Inf(+1), math.Inf(-1)}
+	entire = Interval{math.Inf(-1), math.Inf(+1)}
+)
+
+// IsEmpty reports whether the interval contains no numbers.
+func (x Interval) IsEmpty() bool { return !(x.Lo <= x.Hi) }
+
+// Contains reports whether v lies within the interval.
+func (x Interval) Contains(v float64) bool { return x.Lo <= v && v <= x.Hi }
+
+// hull returns the smallest interval containing both x and y.
+func hull(x, y Interval) Interval {
+	if x.IsEmpty() {
+		return y
+	}
+	if y.IsEmpty() {
+		return x
+	}
+	return Interval{math.Min(x.Lo, y.Lo), math.Max(x.Hi, y.Hi)}
+}
+
+// outward widens x by one unit in the last place at each end,
+// to account for rounding in the computation of its bounds.
+// A NaN bound, such as results from Inf-Inf, becomes infinite.
+func outward(x Interval) Interval {
+	lo, hi := x.Lo, x.Hi
+	if math.IsNaN(lo) {
+		lo = math.Inf(-1)
+	}
+	if math.IsNaN(hi) {
+		hi = math.Inf(+1)
+	}
+	return Interval{math.Nextafter(lo, math.Inf(-1)), math.Nextafter(hi, math.Inf(+1))}
+}
+
+// span returns the interval spanning the values vs, widened outward.
+func span(vs ...float64) Interval {
+	r := empty
+	for _, v := range vs {
+		if math.IsNaN(v) {
+			return entire
+		}
+		r = hull(r, Point(v))
+	}
+	return outward(r)
+}
+
+// ---- truth values ----
+
+// truthInterval returns the interval of truth values:
+// [1, 1] if definitely true, [0, 0] if definitely false, or [0, 1].
+func truthInterval(maybeFalse, maybeTrue bool) Interval {
+	switch {
+	case maybeFalse && maybeTrue:
+		return Interval{0, 1}
+	case maybeTrue:
+		return Point(1)
+	}
+	return Point(0)
+}
+
+// canBeTrue and canBeFalse report whether some value in x is nonzero, or zero.
+func canBeTrue(x Interval) bool  { return !x.IsEmpty() && !(x.Lo == 0 && x.Hi == 0) }
+func canBeFalse(x Interval) bool { return x.Contains(0) }
+
+// ---- arithmetic ----
+
+func addInterval(x, y Interval) Interval { return outward(Interval{x.Lo + y.Lo, x.Hi + y.Hi}) }
+func subInterval(x, y Interval) Interval { return outward(Interval{x.Lo - y.Hi, x.Hi - y.Lo}) }
+
+func mulInterval(x, y Interval) Interval {
+	// By convention, 0 * ±Inf is 0 in interval arithmetic.
+	mul := func(a, b float64) float64 {
+		if a == 0 || b == 0 {
+			return 0
+		}
+		return a * b
+	}
+	return span(mul(x.Lo, y.Lo), mul(x.Lo, y.Hi), mul(x.Hi, y.Lo), mul(x.Hi, y.Hi))
+}
+
+func divInterval(x, y Interval) Interval {
+	switch {
+	case y.Lo > 0 || y.Hi < 0:
+		return mulInterval(x, span(1/y.Lo, 1/y.Hi))
+	case y.Lo == 0 && y.Hi == 0:
+		return empty // division by zero alone is undefined
+	case y.Lo == 0:
+		return mulInterval(x, Interval{math.Nextafter(1/y.Hi, math.Inf(-1)), math.Inf(+1)})
+	case y.Hi == 0:
+		return mulInterval(x, Interval{math.Inf(-1), math.Nextafter(1/y.Lo, math.Inf(+1))})
+	}
+	// y strictly contains zero: x/y is the union of two
+	// half-lines, whose hull is the entire line.
+	return entire
+}
+
+// ---- EvalInterval ----
+
+func (v Var) EvalInterval(env map[Var]Interval) Interval {
+	if x, ok := env[v]; ok {
+		return x
+	}
+	return Point(0) // as for Eval, an absent variable is zero
+}
+
+func (l literal) EvalInterval(_ map[Var]Interval) Interval {
+	return Point(float64(l))
+}
+
+func (u unary) EvalInterval(env map[Var]Interval) Interval {
+	x := u.x.EvalInterval(env)
+	if x.IsEmpty() {
+		return empty
+	}
+	switch u.op {
+	case '+':
+		return x
+	case '-':
+		return Interval{-x.Hi, -x.Lo}
+	case '!':
+		return truthInterval(canBeTrue(x), canBeFalse(x))
+	}
+	return entire
+}
+
+func (b binary) EvalInterval(env map[Var]Interval) Interval {
+	x := b.x.EvalInterval(env)
+	if x.IsEmpty() {
+		return empty
+	}
+	// Logical operators evaluate y only if needed.
+	switch b.op {
+	case opAnd:
+		if !canBeTrue(x) {
+			return Point(0)
+		}
+	case opOr:
+		if !canBeFalse(x) {
+			return Point(1)
+		}
+	}
+	y := b.y.EvalInterval(env)
+	if y.IsEmpty() {
+		return empty
+	}
+	switch b.op {
+	case '+':
+		return addInterval(x, y)
+	case '-':
+		return subInterval(x, y)
+	case '*':
+		return mulInterval(x, y)
+	case '/':
+		return divInterval(x, y)
+	case '<':
+		return truthInterval(x.Hi >= y.Lo, x.Lo < y.Hi)
+	case '>':
+		return truthInterval(x.Lo <= y.Hi, x.Hi > y.Lo)
+	case opLE:
+		return truthInterval(x.Hi > y.Lo, x.Lo <= y.Hi)
+	case opGE:
+		return truthInterval(x.Lo < y.Hi, x.Hi >= y.Lo)
+	case opEQ:
+		overlap := x.Lo <= y.Hi && y.Lo <= x.Hi
+		same := x.Lo == x.Hi && x == y
+		return truthInterval(!same, overlap)
+	case opNE:
+		overlap := x.Lo <= y.Hi && y.Lo <= x.Hi
+		same := x.Lo == x.Hi && x == y
+		return truthInterval(overlap, !same)
+	case opAnd:
+		return truthInterval(canBeFalse(x) || canBeFalse(y), canBeTrue(y))
+	case opOr:
+		return truthInterval(canBeFalse(y), canBeTrue(x) || canBeTrue(y))
+	}
+	return entire
+}
+
+func (c conditional) EvalInterval(env map[Var]Interval) Interval {
+	cond := c.cond.EvalInterval(env)
+	if cond.IsEmpty() {
+		return empty
+	}
+	switch {
+	case !canBeFalse(cond):
+		return c.x.EvalInterval(env)
+	case !canBeTrue(cond):
+		return c.y.EvalInterval(env)
+	}
+	return hull(c.x.EvalInterval(env), c.y.EvalInterval(env))
+}
+
+func (c call) EvalInterval(env map[Var]Interval) Interval {
+	f, ok := stdIntervals[c.fn]
+	if !ok || len(c.args) != std[c.fn].Arity {
+		return entire // nothing is known of other functions
+	}
+	args := make([]Interval, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.EvalInterval(env)
+		if args[i].IsEmpty() {
+			return empty
+		}
+	}
+	return f(args)
+}
+
+// EvalInterval is like Eval, but for intervals.
+func (p *Program) EvalInterval(env map[Var]Interval) Interval {
+	if env == nil {
+		env = make(map[Var]Interval)
+	}
+	for _, s := range p.stmts {
+		env[s.v] = s.x.EvalInterval(env)
+	}
+	return p.result.EvalInterval(env)
+}
+
+// ---- standard functions ----
+
+// stdIntervals holds interval versions of the standard functions.
+// Each argument is non-empty.
+var stdIntervals = map[string]func(args []Interval) Interval{
+	"pow":   powInterval,
+	"sin":   func(a []Interval) Interval { return periodic(a[0], math.Sin, math.Pi/2, -math.Pi/2) },
+	"cos":   func(a []Interval) Interval { return periodic(a[0], math.Cos, 0, math.Pi) },
+	"tan":   tanInterval,
+	"sqrt":  func(a []Interval) Interval { return increasing(a[0], math.Sqrt, 0) },
+	"log":   func(a []Interval) Interval { return increasing(a[0], math.Log, 0) },
+	"exp":   func(a []Interval) Interval { return increasing(a[0], math.Exp, math.Inf(-1)) },
+	"floor": func(a []Interval) Interval { return Interval{math.Floor(a[0].Lo), math.Floor(a[0].Hi)} },
+	"ceil":  func(a []Interval) Interval { return Interval{math.Ceil(a[0].Lo), math.Ceil(a[0].Hi)} },
+	"abs":   func(a []Interval) Interval { return absInterval(a[0]) },
+	"min": func(a []Interval) Interval {
+		return Interval{math.Min(a[0].Lo, a[1].Lo), math.Min(a[0].Hi, a[1].Hi)}
+	},
+	"max": func(a []Interval) Interval {
+		return Interval{math.Max(a[0].Lo, a[1].Lo), math.Max(a[0].Hi, a[1].Hi)}
+	},
+	"hypot": func(a []Interval) Interval {
+		x, y := absInterval(a[0]), absInterval(a[1])
+		return span(math.Hypot(x.Lo, y.Lo), math.Hypot(x.Hi, y.Hi))
+	},
+	"atan2": func(a []Interval) Interval {
+		y, x := a[0], a[1]
+		if x.Lo > 0 {
+			// In the right half-plane, atan2 is monotonic
+			// in each argument, so extrema lie at the corners.
+			return span(math.Atan2(y.Lo, x.Lo), math.Atan2(y.Lo, x.Hi),
+				math.Atan2(y.Hi, x.Lo), math.Atan2(y.Hi, x.Hi))
+		}
+		return outward(Interval{-math.Pi, math.Pi})
+	},
+}
+
+// increasing applies the monotonically increasing function f,
+// whose domain is [min, +Inf], to x.
+func increasing(x Interval, f func(float64) float64, min float64) Interval {
+	if x.Hi < min {
+		return empty
+	}
+	return span(f(math.Max(x.Lo, min)), f(x.Hi))
+}
+
+func absInterval(x Interval) Interval {
+	switch {
+	case x.Lo >= 0:
+		return x
+	case x.Hi <= 0:
+		return Interval{-x.Hi, -x.Lo}
+	}
+	return Interval{0, math.Max(-x.Lo, x.Hi)}
+}
+
+// periodic applies f, which has period 2π, a maximum of 1 at
+// max and a minimum of -1 at min, to x.
+func periodic(x Interval, f func(float64) float64, max, min float64) Interval {
+	if math.IsInf(x.Lo, 0) || math.IsInf(x.Hi, 0) || x.Hi-x.Lo >= 2*math.Pi {
+		return Interval{-1, 1}
+	}
+	r := span(f(x.Lo), f(x.Hi))
+	if containsPeriodic(x, max) {
+		r.Hi = 1
+	}
+	if containsPeriodic(x, min) {
+		r.Lo = -1
+	}
+	return Interval{math.Max(r.Lo, -1), math.Min(r.Hi, 1)}
+}
+
+// containsPeriodic reports whether x contains p + 2kπ for some integer k.
+func containsPeriodic(x Interval, p float64) bool {
+	k := math.Ceil((x.Lo - p) / (2 * math.Pi))
+	return p+2*math.Pi*k <= x.Hi
+}
+
+func tanInterval(a []Interval) Interval {
+	x := a[0]
+	// tan is increasing between its poles at π/2 + kπ.
+	if math.IsInf(x.Lo, 0) || math.IsInf(x.Hi, 0) || x.Hi-x.Lo >= math.Pi {
+		return entire
+	}
+	k := math.Ceil((x.Lo - math.Pi/2) / math.Pi)
+	if math.Pi/2+math.Pi*k <= x.Hi {
+		return entire
+	}
+	return span(math.Tan(x.Lo), math.Tan(x.Hi))
+}
+
+func powInterval(a []Interval) Interval {
+	x, y := a[0], a[1]
+	if x.Lo >= 0 {
+		// For x >= 0, pow is monotonic in each argument,
+		// so extrema lie at the corners.
+		return span(math.Pow(x.Lo, y.Lo), math.Pow(x.Lo, y.Hi),
+			math.Pow(x.Hi, y.Lo), math.Pow(x.Hi, y.Hi))
+	}
+	if n := y.Lo; n == y.Hi && n == math.Trunc(n) {
+		switch {
+		case n == 0:
+			return Point(1)
+		case n < 0 && x.Contains(0):
+			return entire
+		case math.Mod(n, 2) == 0:
+			abs := absInterval(x)
+			return span(math.Pow(abs.Lo, n), math.Pow(abs.Hi, n))
+		}
+		// Odd powers are monotonic away from zero.
+		return span(math.Pow(x.Lo, n), math.Pow(x.Hi, n))
+	}
+
+	// Treat the non-negative and negative parts of x separately.
+	r := empty
+	if x.Hi >= 0 {
+		r = powInterval([]Interval{{0, x.Hi}, y})
+	}
+	// A negative base has a real power only for integer exponents.
+	neg := Interval{x.Lo, math.Min(x.Hi, 0)}
+	lo, hi := math.Ceil(y.Lo), math.Floor(y.Hi)
+	switch {
+	case lo > hi:
+		// no integer exponents
+	case lo == hi:
+		r = hull(r, powInterval([]Interval{neg, Point(lo)}))
+	default:
+		// With both even and odd exponents, the result may have
+		// either sign. Its magnitude |x|**n is monotonic in |x| and
+		// in n, so its greatest value lies at a corner.
+		m := 0.0
+		for _, b := range []float64{math.Abs(neg.Lo), math.Abs(neg.Hi)} {
+			for _, n := range []float64{lo, hi} {
+				m = math.Max(m, math.Pow(b, n))
+			}
+		}
+		r = hull(r, span(-m, m))
+	}
+	return r
+}
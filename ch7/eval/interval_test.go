@@ -0,0 +1,141 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEvalInterval(t *testing.T) {
+	inf := math.Inf(1)
+	for _, test := range []struct {
+		expr   string
+		x      Interval
+		lo, hi float64 // the result must contain [lo, hi]...
+		tight  bool    // ...and, if tight, lie within it (give or take rounding)
+	}{
+		{"x + 1", Interval{1, 2}, 2, 3, true},
+		{"x * x", Interval{-2, 3}, -6, 9, true},
+		{"-x / 2", Interval{-2, 4}, -2, 1, true},
+		{"1 / x", Interval{1, 4}, 0.25, 1, true},
+		{"1 / x", Interval{0, 4}, 0.25, inf, true},
+		{"1 / x", Interval{-4, 0}, -inf, -0.25, true},
+		{"1 / x", Interval{-1, 1}, -inf, inf, true},
+		{"sin(x)", Interval{0, math.Pi}, 0, 1, false},
+		{"sin(x)", Interval{1, 1 + 2*math.Pi}, -1, 1, true},
+		{"cos(x)", Interval{3, 3.5}, -1, math.Cos(3.5), false},
+		{"tan(x)", Interval{1, 2}, -inf, inf, true},
+		{"sqrt(x)", Interval{-4, 9}, 0, 3, true},
+		{"log(x)", Interval{0, 1}, -inf, 0, true},
+		{"abs(x)", Interval{-3, 2}, 0, 3, true},
+		{"pow(x, 2)", Interval{-3, 2}, 0, 9, true},
+		{"pow(x, 3)", Interval{-3, 2}, -27, 8, true},
+		{"x < 0 ? -x : x", Interval{1, 2}, 1, 2, true},
+		{"x < 0 ? -x : x", Interval{-3, 2}, -3, 3, true},
+		{"x > 0 && 1 / x > 1", Interval{-2, -1}, 0, 0, true},
+		{"!x", Interval{1, 2}, 0, 0, true},
+		{"x == 1", Interval{1, 1}, 1, 1, true},
+		{"erf(x)", Interval{0, 1}, -inf, inf, true},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+		got := expr.EvalInterval(map[Var]Interval{"x": test.x})
+		want := Interval{test.lo, test.hi}
+		if !got.Contains(want.Lo) || !got.Contains(want.Hi) {
+			t.Errorf("%s over %v = %v, does not enclose %v", test.expr, test.x, got, want)
+		}
+		if test.tight && (got.Lo < want.Lo-1e-12 || got.Hi > want.Hi+1e-12) {
+			t.Errorf("%s over %v = %v, want %v", test.expr, test.x, got, want)
+		}
+	}
+
+	expr, err := Parse("sqrt(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.EvalInterval(map[Var]Interval{"x": {-2, -1}}); !got.IsEmpty() {
+		t.Errorf("sqrt over [-2, -1] = %v, want empty", got)
+	}
+}
+
+// TestEvalIntervalEncloses checks that the interval result encloses
+// Eval at random points within random input intervals.
+func TestEvalIntervalEncloses(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, input := range []string{
+		"sin(x) / (1 + y * y)",
+		"x * y - cos(x * y)",
+		"pow(x, 3) - 2 * pow(y, 2)",
+		"sqrt(abs(x)) + log(1 + y * y)",
+		"tan(x / 4) + exp(y / 4)",
+		"hypot(x, y) < 2 ? floor(x) : ceil(y)",
+		"atan2(y, 5 + x) + min(x, y) * max(x, y)",
+		"x / y",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		for i := 0; i < 200; i++ {
+			env := make(map[Var]Interval)
+			for _, v := range []Var{"x", "y"} {
+				a, b := rng.Float64()*8-4, rng.Float64()*8-4
+				env[v] = Interval{math.Min(a, b), math.Max(a, b)}
+			}
+			iv := expr.EvalInterval(env)
+			for j := 0; j < 20; j++ {
+				x := env["x"].Lo + rng.Float64()*(env["x"].Hi-env["x"].Lo)
+				y := env["y"].Lo + rng.Float64()*(env["y"].Hi-env["y"].Lo)
+				v := expr.Eval(Env{"x": x, "y": y})
+				if !math.IsNaN(v) && !iv.Contains(v) {
+					t.Fatalf("%s at x=%g, y=%g = %g, outside %v (x in %v, y in %v)",
+						input, x, y, v, iv, env["x"], env["y"])
+				}
+			}
+		}
+	}
+}
+
+// TestPowIntervalEncloses checks pow over random intervals of bases
+// and exponents, including negative bases, at integer exponents,
+// the only ones at which pow of a negative base is defined.
+func TestPowIntervalEncloses(t *testing.T) {
+	for _, test := range []struct {
+		x, y Interval
+		v    float64 // a value of pow(x, y) that must be enclosed
+	}{
+		{Interval{-3, -1}, Interval{1, 3}, 4},      // pow(-2, 2)
+		{Interval{-3, 1}, Interval{2, 3}, -27},     // pow(-3, 3)
+		{Interval{-2, -1}, Interval{0.5, 1.5}, -2}, // pow(-2, 1)
+	} {
+		if got := powInterval([]Interval{test.x, test.y}); !got.Contains(test.v) {
+			t.Errorf("pow(%v, %v) = %v, which excludes %g", test.x, test.y, got, test.v)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	random := func(scale float64) Interval {
+		a, b := rng.Float64()*2*scale-scale, rng.Float64()*2*scale-scale
+		return Interval{math.Min(a, b), math.Max(a, b)}
+	}
+	for i := 0; i < 2000; i++ {
+		x, y := random(4), random(5)
+		iv := powInterval([]Interval{x, y})
+		for j := 0; j < 20; j++ {
+			b := x.Lo + rng.Float64()*(x.Hi-x.Lo)
+			n := y.Lo + rng.Float64()*(y.Hi-y.Lo)
+			if j%2 == 0 && math.Ceil(y.Lo) <= y.Hi {
+				// an integer exponent within y
+				n = math.Ceil(y.Lo) + math.Floor(rng.Float64()*(math.Floor(y.Hi)-math.Ceil(y.Lo)+1))
+			}
+			if v := math.Pow(b, n); !math.IsNaN(v) && !iv.Contains(v) {
+				t.Fatalf("pow(%g, %g) = %g, outside pow(%v, %v) = %v", b, n, v, x, y, iv)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ package eval
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"text/scanner"
@@ -15,13 +16,53 @@ import (
 // This lexer is similar to the one described in Chapter 13.
 type lexer struct {
 	scan  scanner.Scanner
-	token rune // current lookahead token
+	token rune                     // current lookahead token
+	pos   scanner.Position         // position of token
+	uses  map[Var]scanner.Position // if non-nil, first use of each Var parsed
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
 func (lex *lexer) text() string { return lex.scan.TokenText() }
 
-type lexPanic string
+// next advances to the next token, combining the characters
+// of a two-character operator such as <= or && into one token.
+func (lex *lexer) next() {
+	lex.token = lex.scan.Scan()
+	lex.pos = lex.scan.Position // (Next invalidates lex.scan.Position)
+	if op, ok := twoCharOps[string([]rune{lex.token, lex.scan.Peek()})]; ok {
+		lex.scan.Next() // consume second character
+		lex.token = op
+	}
+}
+
+var twoCharOps = map[string]rune{
+	"<=": opLE, ">=": opGE, "==": opEQ, "!=": opNE, "&&": opAnd, "||": opOr,
+}
+
+// A lexPanic carries a syntax error from the point of
+// detection back to Parse.
+type lexPanic struct{ err *Error }
+
+// syntaxError returns a syntax error at the current token.
+func (lex *lexer) syntaxError(msg string, expected ...string) lexPanic {
+	return lexPanic{&Error{
+		Pos:      lex.pos,
+		Token:    lex.tokenText(),
+		Expected: expected,
+		Msg:      msg,
+	}}
+}
+
+// tokenText returns the source text of the current token,
+// or "" at end of file.
+func (lex *lexer) tokenText() string {
+	switch lex.token {
+	case scanner.EOF:
+		return ""
+	case opLE, opGE, opEQ, opNE, opAnd, opOr:
+		return opText(lex.token)
+	}
+	return lex.text()
+}
 
 // describe returns a string describing the current token, for use in errors.
 func (lex *lexer) describe() string {
@@ -32,15 +73,27 @@ func (lex *lexer) describe() string {
 		return fmt.Sprintf("identifier %s", lex.text())
 	case scanner.Int, scanner.Float:
 		return fmt.Sprintf("number %s", lex.text())
+	case opLE, opGE, opEQ, opNE, opAnd, opOr:
+		return fmt.Sprintf("'%s'", opText(lex.token))
 	}
 	return fmt.Sprintf("%q", rune(lex.token)) // any other rune
 }
 
+// precedence returns the binding strength of the binary operator op,
+// following C, or zero if op is not a binary operator.
 func precedence(op rune) int {
 	switch op {
 	case '*', '/':
-		return 2
+		return 6
 	case '+', '-':
+		return 5
+	case '<', '>', opLE, opGE:
+		return 4
+	case opEQ, opNE:
+		return 3
+	case opAnd:
+		return 2
+	case opOr:
 		return 1
 	}
 	return 0
@@ -50,36 +103,68 @@ func precedence(op rune) int {
 
 // Parse parses the input string as an arithmetic expression.
 //
-//   expr = num                         a literal number, e.g., 3.14159
+//   expr = num                         a literal number, e.g., 3.14159, -2, Inf or NaN
 //        | id                          a variable name, e.g., x
 //        | id '(' expr ',' ... ')'     a function call
-//        | '-' expr                    a unary operator (+-)
-//        | expr '+' expr               a binary operator (+-*/)
+//        | '-' expr                    a unary operator (+-!)
+//        | expr '+' expr               a binary operator (+-*/ < > <= >= == != && ||)
+//        | expr '?' expr ':' expr      a conditional
+//
+// A unary minus sign applied to a number is part of the literal, so
+// -2 is a literal but -(2) is the negation of one. The names Inf and
+// NaN denote the floating-point infinity and not-a-number, not Vars.
 //
+// Comparison and logical operators yield 1 for true and 0 for false;
+// any nonzero operand counts as true.
+//
+// A syntax error is reported as an *Error.
 func Parse(input string) (_ Expr, err error) {
 	defer func() {
 		switch x := recover().(type) {
 		case nil:
 			// no panic
 		case lexPanic:
-			err = fmt.Errorf("%s", x)
+			err = x.err
 		default:
 			// unexpected panic: resume state of panic.
 			panic(x)
 		}
 	}()
-	lex := new(lexer)
-	lex.scan.Init(strings.NewReader(input))
-	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats
-	lex.next() // initial lookahead
+	lex := newLexer(input)
 	e := parseExpr(lex)
 	if lex.token != scanner.EOF {
-		return nil, fmt.Errorf("unexpected %s", lex.describe())
+		return nil, lex.syntaxError(fmt.Sprintf("unexpected %s", lex.describe()),
+			"operator", "end of file").err
 	}
 	return e, nil
 }
 
-func parseExpr(lex *lexer) Expr { return parseBinary(lex, 1) }
+// newLexer returns a lexer for input, positioned at its first token.
+func newLexer(input string) *lexer {
+	lex := new(lexer)
+	lex.scan.Init(strings.NewReader(input))
+	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats
+	lex.next() // initial lookahead
+	return lex
+}
+
+func parseExpr(lex *lexer) Expr { return parseConditional(lex) }
+
+// conditional = binary ('?' expr ':' conditional)?
+func parseConditional(lex *lexer) Expr {
+	cond := parseBinary(lex, 1)
+	if lex.token != '?' {
+		return cond
+	}
+	lex.next() // consume '?'
+	x := parseExpr(lex)
+	if lex.token != ':' {
+		panic(lex.syntaxError(fmt.Sprintf("got %s, want ':'", lex.describe()), ":"))
+	}
+	lex.next() // consume ':'
+	y := parseConditional(lex)
+	return conditional{cond, x, y}
+}
 
 // binary = unary ('+' binary)*
 // parseBinary stops when it encounters an
@@ -97,26 +182,56 @@ func parseBinary(lex *lexer, prec1 int) Expr {
 	return lhs
 }
 
-// unary = '+' expr | primary
+// unary = '+' expr | '-' num | primary
 func parseUnary(lex *lexer) Expr {
-	if lex.token == '+' || lex.token == '-' {
+	if lex.token == '+' || lex.token == '-' || lex.token == '!' {
 		op := lex.token
-		lex.next() // consume '+' or '-'
+		lex.next() // consume '+', '-' or '!'
+		if op == '-' && lex.isNumber() {
+			// A minus sign before a number is part of the literal.
+			x := parsePrimary(lex)
+			if l, ok := x.(literal); ok {
+				return -l
+			}
+			return unary{op, x} // a call to a function named Inf or NaN
+		}
 		return unary{op, parseUnary(lex)}
 	}
 	return parsePrimary(lex)
 }
 
+// isNumber reports whether the current token is a number,
+// including the names Inf and NaN.
+func (lex *lexer) isNumber() bool {
+	switch lex.token {
+	case scanner.Int, scanner.Float:
+		return true
+	case scanner.Ident:
+		return lex.text() == "Inf" || lex.text() == "NaN"
+	}
+	return false
+}
+
 // primary = id
 //         | id '(' expr ',' ... ',' expr ')'
 //         | num
+//         | 'Inf' | 'NaN'
 //         | '(' expr ')'
 func parsePrimary(lex *lexer) Expr {
 	switch lex.token {
 	case scanner.Ident:
-		id := lex.text()
+		id, pos := lex.text(), lex.pos
 		lex.next() // consume Ident
 		if lex.token != '(' {
+			switch id {
+			case "Inf":
+				return literal(math.Inf(+1))
+			case "NaN":
+				return literal(math.NaN())
+			}
+			if _, ok := lex.uses[Var(id)]; !ok && lex.uses != nil {
+				lex.uses[Var(id)] = pos
+			}
 			return Var(id)
 		}
 		lex.next() // consume '('
@@ -130,17 +245,16 @@ func parsePrimary(lex *lexer) Expr {
 				lex.next() // consume ','
 			}
 			if lex.token != ')' {
-				msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-				panic(lexPanic(msg))
+				panic(lex.syntaxError(fmt.Sprintf("got %s, want ')'", lex.describe()), ",", ")"))
 			}
 		}
 		lex.next() // consume ')'
-		return call{id, args}
+		return call{id, args, pos}
 
 	case scanner.Int, scanner.Float:
 		f, err := strconv.ParseFloat(lex.text(), 64)
 		if err != nil {
-			panic(lexPanic(err.Error()))
+			panic(lex.syntaxError(err.Error()))
 		}
 		lex.next() // consume number
 		return literal(f)
@@ -149,12 +263,11 @@ func parsePrimary(lex *lexer) Expr {
 		lex.next() // consume '('
 		e := parseExpr(lex)
 		if lex.token != ')' {
-			msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-			panic(lexPanic(msg))
+			panic(lex.syntaxError(fmt.Sprintf("got %s, want ')'", lex.describe()), ")"))
 		}
 		lex.next() // consume ')'
 		return e
 	}
-	msg := fmt.Sprintf("unexpected %s", lex.describe())
-	panic(lexPanic(msg))
+	panic(lex.syntaxError(fmt.Sprintf("unexpected %s", lex.describe()),
+		"identifier", "number", "(", "+", "-", "!"))
 }
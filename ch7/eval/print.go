@@ -6,6 +6,10 @@ package eval
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"strings"
+
+	"gopl.io/ch12/sexpr"
 )
 
 // Format formats an expression as a string.
@@ -19,20 +23,35 @@ func Format(e Expr) string {
 func write(buf *bytes.Buffer, e Expr) {
 	switch e := e.(type) {
 	case literal:
-		fmt.Fprintf(buf, "%g", e)
+		buf.WriteString(literalText(e))
 
 	case Var:
 		fmt.Fprintf(buf, "%s", e)
 
 	case unary:
 		fmt.Fprintf(buf, "(%c", e.op)
-		write(buf, e.x)
+		if negatesNumber(e) {
+			buf.WriteByte('(')
+			write(buf, e.x)
+			buf.WriteByte(')')
+		} else {
+			write(buf, e.x)
+		}
 		buf.WriteByte(')')
 
 	case binary:
 		buf.WriteByte('(')
 		write(buf, e.x)
-		fmt.Fprintf(buf, " %c ", e.op)
+		fmt.Fprintf(buf, " %s ", opText(e.op))
+		write(buf, e.y)
+		buf.WriteByte(')')
+
+	case conditional:
+		buf.WriteByte('(')
+		write(buf, e.cond)
+		buf.WriteString(" ? ")
+		write(buf, e.x)
+		buf.WriteString(" : ")
 		write(buf, e.y)
 		buf.WriteByte(')')
 
@@ -50,3 +69,124 @@ func write(buf *bytes.Buffer, e Expr) {
 		panic(fmt.Sprintf("unknown Expr: %T", e))
 	}
 }
+
+// literalText returns the text of l, in a form that Parse accepts:
+// an optional minus sign followed by a number, Inf, or NaN.
+func literalText(l literal) string {
+	if math.IsInf(float64(l), +1) {
+		return "Inf" // not "+Inf", which would parse as a unary operator
+	}
+	return fmt.Sprintf("%g", float64(l))
+}
+
+// negatesNumber reports whether u applies '-' to a literal that
+// prints without a sign. Since Parse folds such a sign into the
+// literal, the operand must be parenthesized.
+func negatesNumber(u unary) bool {
+	l, ok := u.x.(literal)
+	return ok && u.op == '-' && !strings.HasPrefix(literalText(l), "-")
+}
+
+// FormatMinimal formats an expression as a string, like Format,
+// but emits only the parentheses needed to preserve its structure.
+//
+// For any expression e, Parse(FormatMinimal(e)) is structurally
+// equal to e, apart from the positions of calls and the sign of NaN.
+func FormatMinimal(e Expr) string {
+	return FormatWidth(e, math.MaxInt32)
+}
+
+// FormatWidth formats an expression like FormatMinimal, but breaks
+// lines before operators and after commas so that, where possible,
+// no line is longer than width. Continuation lines are indented
+// relative to the start of the subexpression they continue.
+func FormatWidth(e Expr, width int) string {
+	p := sexpr.NewPrinter(sexpr.PrinterOptions{Width: width, Indent: 4})
+	p.Begin()
+	writeMinimal(p, e, 0)
+	p.End()
+	return string(p.Bytes())
+}
+
+// Binding strengths of the non-binary forms, relative to precedence.
+const (
+	condPrec    = 0 // x ? y : z
+	unaryPrec   = 7 // -x
+	primaryPrec = 8 // x, 1, f(x), (x)
+)
+
+// exprPrec returns the binding strength of the outermost form of e.
+func exprPrec(e Expr) int {
+	switch e := e.(type) {
+	case literal:
+		if strings.HasPrefix(literalText(e), "-") {
+			return unaryPrec
+		}
+	case unary:
+		return unaryPrec
+	case binary:
+		return precedence(e.op)
+	case conditional:
+		return condPrec
+	}
+	return primaryPrec
+}
+
+// writeMinimal writes e, parenthesized if its binding
+// strength is less than that required by the context, prec.
+func writeMinimal(p *sexpr.Printer, e Expr, prec int) {
+	paren := exprPrec(e) < prec
+	if paren {
+		p.Text("(")
+	}
+	switch e := e.(type) {
+	case unary:
+		p.Text(string(e.op))
+		if negatesNumber(e) {
+			writeMinimal(p, e.x, primaryPrec+1) // parenthesized
+		} else {
+			writeMinimal(p, e.x, unaryPrec)
+		}
+
+	case binary:
+		// Binary operators are left-associative.
+		prec := precedence(e.op)
+		p.Begin()
+		writeMinimal(p, e.x, prec)
+		p.Space()
+		p.Text(opText(e.op) + " ")
+		writeMinimal(p, e.y, prec+1)
+		p.End()
+
+	case conditional:
+		// The conditional operator is right-associative.
+		p.Begin()
+		writeMinimal(p, e.cond, condPrec+1)
+		p.Space()
+		p.Text("? ")
+		writeMinimal(p, e.x, condPrec)
+		p.Space()
+		p.Text(": ")
+		writeMinimal(p, e.y, condPrec)
+		p.End()
+
+	case call:
+		p.Begin()
+		p.Text(e.fn + "(")
+		for i, arg := range e.args {
+			if i > 0 {
+				p.Text(",")
+				p.Space()
+			}
+			writeMinimal(p, arg, condPrec)
+		}
+		p.Text(")")
+		p.End()
+
+	default:
+		p.Text(Format(e))
+	}
+	if paren {
+		p.Text(")")
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFormatMinimal(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"(x)", "x"},
+		{"(1 + 2) + 3", "1 + 2 + 3"},
+		{"1 + (2 + 3)", "1 + (2 + 3)"},
+		{"(a * b) + (c / d)", "a * b + c / d"},
+		{"(a + b) * (c - d)", "(a + b) * (c - d)"},
+		{"-(x)", "-x"},
+		{"-(x + y)", "-(x + y)"},
+		{"--x", "--x"},
+		{"sin((x))", "sin(x)"},
+		{"pow((x + 1), (2))", "pow(x + 1, 2)"},
+		{"(a < b) && (c >= d) || !e", "a < b && c >= d || !e"},
+		{"a && (b || c)", "a && (b || c)"},
+		{"(x < 0) ? (-x) : (x)", "x < 0 ? -x : x"},
+		{"a ? b : (c ? d : e)", "a ? b : c ? d : e"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e"},
+		{"a ? (b ? c : d) : e", "a ? b ? c : d : e"},
+		{"(a ? b : c) + 1", "(a ? b : c) + 1"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := FormatMinimal(expr); got != test.want {
+			t.Errorf("FormatMinimal(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestFormatWidth(t *testing.T) {
+	const input = "x > 0 ? pow(sin(x) + cos(y), 2) * hypot(x - 1, y + 2) : -(x + y) / (1 + exp(-x * y))"
+	for _, test := range []struct {
+		width int
+		want  string
+	}{
+		{100, input},
+		{60, `x > 0 ? pow(sin(x) + cos(y), 2) * hypot(x - 1, y + 2)
+    : -(x + y) / (1 + exp(-x * y))`},
+		{30, `x > 0
+    ? pow(sin(x) + cos(y), 2)
+          * hypot(x - 1,
+                y + 2)
+    : -(x + y)
+          / (1 + exp(-x * y))`},
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FormatWidth(expr, test.width); got != test.want {
+			t.Errorf("FormatWidth(%s, %d) =\n%s\nwant\n%s", input, test.width, got, test.want)
+		}
+	}
+}
+
+// TestFormatRoundTrip checks that Parse(FormatMinimal(e)),
+// Parse(FormatWidth(e, 20)) and Parse(Format(e)) yield e for randomly
+// generated expressions, and for the results of simplifying them.
+func TestFormatRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	narrow := func(e Expr) string { return FormatWidth(e, 20) }
+	for i := 0; i < 10000; i++ {
+		e := randomExpr(rng, 5)
+		for _, e := range []Expr{e, Simplify(e)} {
+			for _, format := range []func(Expr) string{Format, FormatMinimal, narrow} {
+				s := format(e)
+				got, err := Parse(s)
+				if err != nil {
+					t.Fatalf("Parse(%s): %v", s, err)
+				}
+				if !equalExpr(got, e) {
+					t.Fatalf("Parse(%s) = %s, want %s", s, Format(got), Format(e))
+				}
+			}
+		}
+	}
+
+	// Negative and non-finite literals, and negated numbers.
+	for _, test := range []struct {
+		e    Expr
+		want string
+	}{
+		{literal(-3), "-3"},
+		{unary{'-', literal(3)}, "-(3)"},
+		{unary{'-', literal(-3)}, "--3"},
+		{literal(math.Inf(+1)), "Inf"},
+		{literal(math.Inf(-1)), "-Inf"},
+		{unary{'+', literal(math.Inf(+1))}, "+Inf"},
+		{literal(math.NaN()), "NaN"},
+		{binary{'-', Var("x"), literal(-2)}, "x - -2"},
+		{binary{'*', literal(-2), Var("x")}, "-2 * x"},
+	} {
+		s := FormatMinimal(test.e)
+		if s != test.want {
+			t.Errorf("FormatMinimal(%s) = %s, want %s", Format(test.e), s, test.want)
+		}
+		if got, err := Parse(s); err != nil || !equalExpr(got, test.e) {
+			t.Errorf("Parse(%s) = %v, %v, want %s", s, got, err, Format(test.e))
+		}
+	}
+}
+
+// equalExpr reports whether x and y are the same tree,
+// ignoring the positions of calls.
+func equalExpr(x, y Expr) bool {
+	switch x := x.(type) {
+	case literal:
+		y, ok := y.(literal)
+		if x != x { // NaN
+			return ok && y != y
+		}
+		return ok && math.Float64bits(float64(x)) == math.Float64bits(float64(y))
+	case Var:
+		return x == y
+	case unary:
+		y, ok := y.(unary)
+		return ok && x.op == y.op && equalExpr(x.x, y.x)
+	case binary:
+		y, ok := y.(binary)
+		return ok && x.op == y.op && equalExpr(x.x, y.x) && equalExpr(x.y, y.y)
+	case conditional:
+		y, ok := y.(conditional)
+		return ok && equalExpr(x.cond, y.cond) && equalExpr(x.x, y.x) && equalExpr(x.y, y.y)
+	case call:
+		y, ok := y.(call)
+		if !ok || x.fn != y.fn || len(x.args) != len(y.args) {
+			return false
+		}
+		for i := range x.args {
+			if !equalExpr(x.args[i], y.args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	panic(fmt.Sprintf("unexpected Expr: %T", x))
+}
+
+// randomExpr returns a random expression, with nesting
+// no deeper than depth.
+func randomExpr(rng *rand.Rand, depth int) Expr {
+	n := 3
+	if depth > 0 {
+		n = 7
+	}
+	switch rng.Intn(n) {
+	case 0:
+		return literal(rng.Intn(100))
+	case 1:
+		// Literals such as those made by Simplify and Derive,
+		// which Parse yields only from signed or named numbers.
+		special := []float64{math.Inf(+1), math.Inf(-1), math.NaN(), math.Copysign(0, -1), -1e300}
+		if i := rng.Intn(2 * len(special)); i < len(special) {
+			return literal(special[i])
+		}
+		return literal((rng.Float64() - 0.5) * 1e3)
+	case 2:
+		return Var("xyz"[rng.Intn(3):][:1])
+	case 3:
+		return unary{rune("+-!"[rng.Intn(3)]), randomExpr(rng, depth-1)}
+	case 4:
+		ops := []rune{'+', '-', '*', '/', '<', '>', opLE, opGE, opEQ, opNE, opAnd, opOr}
+		op := ops[rng.Intn(len(ops))]
+		return binary{op, randomExpr(rng, depth-1), randomExpr(rng, depth-1)}
+	case 5:
+		return conditional{randomExpr(rng, depth-1), randomExpr(rng, depth-1), randomExpr(rng, depth-1)}
+	}
+	var args []Expr
+	for i := rng.Intn(3); i > 0; i-- {
+		args = append(args, randomExpr(rng, depth-1))
+	}
+	return call{fn: "f", args: args}
+}
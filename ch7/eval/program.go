@@ -0,0 +1,215 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"text/scanner"
+)
+
+// A Program is a sequence of assignments followed by an expression,
+// e.g., r = hypot(x, y); sin(r) / r.
+type Program struct {
+	stmts      []assign
+	result     Expr
+	resultUses uses
+}
+
+// An assign represents an assignment statement, e.g., r = hypot(x, y).
+type assign struct {
+	v    Var
+	x    Expr
+	uses uses
+}
+
+// uses holds the position of the first use of each Var in an expression.
+type uses map[Var]scanner.Position
+
+// ParseProgram parses the input string as a program.
+//
+//   program = (id '=' expr ';')* expr ';'?
+//
+// where expr is as for Parse.
+// A syntax error is reported as an *Error.
+func ParseProgram(input string) (_ *Program, err error) {
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case lexPanic:
+			err = x.err
+		default:
+			// unexpected panic: resume state of panic.
+			panic(x)
+		}
+	}()
+	lex := newLexer(input)
+	p := new(Program)
+	for {
+		start := lex.token
+		lex.uses = make(uses)
+		e := parseExpr(lex)
+		if lex.token != '=' {
+			p.result, p.resultUses = e, lex.uses
+			break
+		}
+		v, ok := e.(Var)
+		if !ok || start != scanner.Ident { // not a variable, or parenthesized
+			panic(lex.syntaxError(fmt.Sprintf("unexpected %s", lex.describe()),
+				"operator", ";", "end of file"))
+		}
+		lex.next() // consume '='
+		lex.uses = make(uses)
+		x := parseExpr(lex)
+		if lex.token != ';' {
+			panic(lex.syntaxError(fmt.Sprintf("got %s, want ';'", lex.describe()), ";"))
+		}
+		lex.next() // consume ';'
+		p.stmts = append(p.stmts, assign{v, x, lex.uses})
+	}
+	if lex.token == ';' {
+		lex.next() // consume optional final ';'
+	}
+	if lex.token != scanner.EOF {
+		return nil, lex.syntaxError(fmt.Sprintf("unexpected %s", lex.describe()),
+			"operator", "=", ";", "end of file").err
+	}
+	return p, nil
+}
+
+// Check reports errors in this Program and adds its
+// free variables, those it does not assign, to the set.
+//
+// A variable assigned anywhere in the program must not be
+// used before its first assignment, even if it also appears
+// in the environment.
+// Like Expr.Check, it reports all errors as an ErrorList.
+func (p *Program) Check(vars map[Var]bool) error { return p.check(vars, nil) }
+
+// CheckProgram is like p.Check, but resolves function calls using fs.
+func (fs Funcs) CheckProgram(p *Program, vars map[Var]bool) error { return p.check(vars, fs) }
+
+func (p *Program) check(vars map[Var]bool, fs Funcs) error {
+	locals := make(map[Var]bool)
+	for _, s := range p.stmts {
+		locals[s.v] = true
+	}
+	var errs ErrorList
+	defined := make(map[Var]bool)
+	checkUses := func(e Expr, pos uses) {
+		used := make(map[Var]bool)
+		errs.add(e.check(used, fs))
+		var names []string
+		for v := range used {
+			names = append(names, string(v))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v := Var(name)
+			switch {
+			case defined[v]:
+				// ok
+			case locals[v]:
+				errs.add(&Error{
+					Pos:   pos[v],
+					Token: name,
+					Msg:   fmt.Sprintf("%s used before definition", name),
+				})
+			default:
+				vars[v] = true
+			}
+		}
+	}
+	for _, s := range p.stmts {
+		checkUses(s.x, s.uses)
+		defined[s.v] = true
+	}
+	checkUses(p.result, p.resultUses)
+	return errs.Err()
+}
+
+// Eval returns the value of this Program in the environment env.
+// Each assignment extends env, so after Eval returns env
+// holds the final value of every assigned variable.
+// If env is nil, a new environment is used.
+func (p *Program) Eval(env Env) float64 { return p.eval(env, nil) }
+
+// EvalProgram is like p.Eval, but resolves function calls using fs.
+func (fs Funcs) EvalProgram(p *Program, env Env) float64 { return p.eval(env, fs) }
+
+func (p *Program) eval(env Env, fs Funcs) float64 {
+	if env == nil {
+		env = make(Env)
+	}
+	for _, s := range p.stmts {
+		env[s.v] = s.x.eval(env, fs)
+	}
+	return p.result.eval(env, fs)
+}
+
+// Compile is like the Compile function, but for a program.
+func (p *Program) Compile(vars []Var) (func(args []float64) float64, error) {
+	return Funcs(nil).CompileProgram(p, vars)
+}
+
+// CompileProgram is like p.Compile, but resolves function calls using fs.
+func (fs Funcs) CompileProgram(p *Program, vars []Var) (func(args []float64) float64, error) {
+	slots := make(map[Var]int)
+	for i, v := range vars {
+		if _, dup := slots[v]; dup {
+			return nil, fmt.Errorf("duplicate variable: %s", v)
+		}
+		slots[v] = i
+	}
+	n := len(vars)
+	stmts := make([]compiled, len(p.stmts))
+	dest := make([]int, len(p.stmts))
+	for i, s := range p.stmts {
+		f, err := compile(s.x, slots, fs)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := slots[s.v]; !ok {
+			slots[s.v] = len(slots)
+		}
+		stmts[i], dest[i] = f, slots[s.v]
+	}
+	result, err := compile(p.result, slots, fs)
+	if err != nil {
+		return nil, err
+	}
+	// The frame holds the arguments followed by the assigned variables.
+	// One frame cannot be shared by all calls, since the function may
+	// be called concurrently, or reentrantly from a Func that it calls,
+	// so frames are reused through a pool. Each assigned variable is
+	// stored before it is loaded, so a reused frame need not be cleared.
+	size := len(slots)
+	frames := sync.Pool{New: func() interface{} {
+		frame := make([]float64, size)
+		return &frame
+	}}
+	return func(args []float64) float64 {
+		frame := frames.Get().(*[]float64)
+		copy(*frame, args[:n])
+		for i, f := range stmts {
+			(*frame)[dest[i]] = f(*frame)
+		}
+		x := result(*frame)
+		frames.Put(frame)
+		return x
+	}, nil
+}
+
+// String formats the program, with one space after each semicolon.
+func (p *Program) String() string {
+	var buf bytes.Buffer
+	for _, s := range p.stmts {
+		fmt.Fprintf(&buf, "%s = %s; ", s.v, FormatMinimal(s.x))
+	}
+	buf.WriteString(FormatMinimal(p.result))
+	return buf.String()
+}
@@ -0,0 +1,192 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		env   Env
+		want  string
+		vars  []Var // free variables, sorted
+		str   string
+	}{
+		{"r = hypot(x, y); sin(r) / r", Env{"x": 3, "y": 4}, "-0.191785",
+			[]Var{"x", "y"}, "r = hypot(x, y); sin(r) / r"},
+		{"a = 2; b = a * a; a = b + 1; a * b;", nil, "20",
+			nil, "a = 2; b = a * a; a = b + 1; a * b"},
+		{"x + 1", Env{"x": 1}, "2", []Var{"x"}, "x + 1"},
+		{"f = c * 9 / 5 + 32;\nf", Env{"c": 100}, "212", []Var{"c"}, "f = c * 9 / 5 + 32; f"},
+	} {
+		p, err := ParseProgram(test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		vars := make(map[Var]bool)
+		if err := p.Check(vars); err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		var free []Var
+		for _, v := range []Var{"a", "b", "c", "f", "r", "x", "y"} {
+			if vars[v] {
+				free = append(free, v)
+			}
+		}
+		if !reflect.DeepEqual(free, test.vars) {
+			t.Errorf("%s: free variables %v, want %v", test.input, free, test.vars)
+		}
+		if got := p.String(); got != test.str {
+			t.Errorf("%s: String() = %q, want %q", test.input, got, test.str)
+		}
+		if got := fmt.Sprintf("%.6g", p.Eval(test.env)); got != test.want {
+			t.Errorf("%s: Eval(%v) = %s, want %s", test.input, test.env, got, test.want)
+		}
+		f, err := p.Compile(test.vars)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		args := make([]float64, len(test.vars))
+		for i, v := range test.vars {
+			args[i] = test.env[v]
+		}
+		if got := fmt.Sprintf("%.6g", f(args)); got != test.want {
+			t.Errorf("%s: compiled = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestProgramEnv(t *testing.T) {
+	p, err := ParseProgram("r = hypot(x, y); r * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Env{"x": 3, "y": 4}
+	if got := p.Eval(env); got != 10 {
+		t.Errorf("Eval = %g, want 10", got)
+	}
+	if env["r"] != 5 {
+		t.Errorf("after Eval, r = %g, want 5", env["r"])
+	}
+}
+
+func TestProgramFuncs(t *testing.T) {
+	fs := Funcs{"double": {1, func(a ...float64) float64 { return 2 * a[0] }}}
+	p, err := ParseProgram("r = double(x); r + sin(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check(map[Var]bool{}); err == nil {
+		t.Errorf("Check of %s without table succeeded", p)
+	}
+	vars := map[Var]bool{}
+	if err := fs.CheckProgram(p, vars); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vars, map[Var]bool{"x": true}) {
+		t.Errorf("CheckProgram vars = %v, want x", vars)
+	}
+	if got := fs.EvalProgram(p, Env{"x": 3}); got != 6 {
+		t.Errorf("EvalProgram = %g, want 6", got)
+	}
+	if _, err := p.Compile([]Var{"x"}); err == nil {
+		t.Errorf("Compile of %s without table succeeded", p)
+	}
+	f, err := fs.CompileProgram(p, []Var{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f([]float64{4}); got != 8 {
+		t.Errorf("compiled program = %g, want 8", got)
+	}
+}
+
+func TestCompiledProgramFrames(t *testing.T) {
+	p, err := ParseProgram("y = x * x; z = y + 1; z * x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := p.Compile([]Var{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []float64{2}
+	if n := testing.AllocsPerRun(100, func() { f(args) }); n != 0 {
+		t.Errorf("compiled program allocates %g times per call", n)
+	}
+
+	// Concurrent calls do not share a frame.
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(x float64) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if got, want := f([]float64{x}), (x*x+1)*x; got != want {
+					t.Errorf("f(%g) = %g, want %g", x, got, want)
+					return
+				}
+			}
+		}(float64(g))
+	}
+	wg.Wait()
+}
+
+func TestProgramErrors(t *testing.T) {
+	for _, test := range []struct{ input, wantErr string }{
+		{"x = 1", "got end of file, want ';'"},
+		{"1 = 2; x", "unexpected '='"},
+		{"(x) = 1; x", "unexpected '='"},
+		{"x + 1; y", "unexpected identifier y"},
+		{"y = r * 2; r = hypot(x, y); sin(r)", "r used before definition"},
+		{"x = x + 1; x", "x used before definition"},
+		{"a = erf(1); a * b", `unknown function "erf"`},
+		{"a = c; sqrt(a, b)", "call to sqrt has 2 args, want 1"},
+	} {
+		p, err := ParseProgram(test.input)
+		if err == nil {
+			err = p.Check(map[Var]bool{})
+		}
+		if err == nil {
+			t.Errorf("%s: unexpected success", test.input)
+			continue
+		}
+		if err.Error() != test.wantErr {
+			t.Errorf("%s: got error %s, want %s", test.input, err, test.wantErr)
+		}
+	}
+}
+
+func TestProgramErrorPos(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  string // line:column of the offending use
+	}{
+		{"y = 1 + r * 2; r = 1; r", "1:9"},
+		{"a = 1;\nb = a + c;\nc = 2; b", "2:9"},
+		{"x = 2 * x; x", "1:9"},
+	} {
+		p, err := ParseProgram(test.input)
+		if err == nil {
+			err = p.Check(map[Var]bool{})
+		}
+		list, ok := err.(ErrorList)
+		if !ok || len(list) == 0 {
+			t.Errorf("%s: got error %v, want an ErrorList", test.input, err)
+			continue
+		}
+		pos := list[0].Pos
+		if got := fmt.Sprintf("%d:%d", pos.Line, pos.Column); got != test.want {
+			t.Errorf("%s: error at %s, want %s", test.input, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+// Simplify returns an expression equivalent to e in which constant
+// subexpressions have been folded and trivial identities such as
+// x+0, x*1 and --x have been removed.
+//
+// Simplify treats x*0 and 0/x as zero, which is not strictly true
+// when x is infinite or NaN. It folds calls only to the standard
+// functions, and assumes they have their standard meaning.
+func Simplify(e Expr) Expr {
+	switch e := e.(type) {
+	case unary:
+		x := Simplify(e.x)
+		if _, ok := x.(literal); ok {
+			return literal(unary{e.op, x}.Eval(nil))
+		}
+		switch e.op {
+		case '+':
+			return x
+		case '-':
+			if u, ok := x.(unary); ok && u.op == '-' {
+				return u.x
+			}
+		}
+		return unary{e.op, x}
+
+	case binary:
+		x, y := Simplify(e.x), Simplify(e.y)
+		_, xconst := x.(literal)
+		_, yconst := y.(literal)
+		if xconst && yconst {
+			return literal(binary{e.op, x, y}.Eval(nil))
+		}
+		switch e.op {
+		case '+':
+			if isLiteral(x, 0) {
+				return y
+			}
+			if isLiteral(y, 0) {
+				return x
+			}
+		case '-':
+			if isLiteral(y, 0) {
+				return x
+			}
+			if isLiteral(x, 0) {
+				return Simplify(unary{'-', y})
+			}
+		case '*':
+			if isLiteral(x, 0) || isLiteral(y, 0) {
+				return literal(0)
+			}
+			if isLiteral(x, 1) {
+				return y
+			}
+			if isLiteral(y, 1) {
+				return x
+			}
+			if isLiteral(x, -1) {
+				return Simplify(unary{'-', y})
+			}
+			if isLiteral(y, -1) {
+				return Simplify(unary{'-', x})
+			}
+		case '/':
+			if isLiteral(x, 0) {
+				return literal(0)
+			}
+			if isLiteral(y, 1) {
+				return x
+			}
+		}
+		if e.op == '*' || e.op == '/' {
+			// Hoist negation so that it may cancel: (-x)*y => -(x*y).
+			if u, ok := x.(unary); ok && u.op == '-' {
+				return Simplify(unary{'-', binary{e.op, u.x, y}})
+			}
+			if u, ok := y.(unary); ok && u.op == '-' {
+				return Simplify(unary{'-', binary{e.op, x, u.x}})
+			}
+		}
+		return binary{e.op, x, y}
+
+	case conditional:
+		cond := Simplify(e.cond)
+		x, y := Simplify(e.x), Simplify(e.y)
+		if c, ok := cond.(literal); ok {
+			if c != 0 {
+				return x
+			}
+			return y
+		}
+		return conditional{cond, x, y}
+
+	case call:
+		args := make([]Expr, len(e.args))
+		vals := make([]float64, len(e.args))
+		allConst := true
+		for i, arg := range e.args {
+			args[i] = Simplify(arg)
+			if l, ok := args[i].(literal); ok {
+				vals[i] = float64(l)
+			} else {
+				allConst = false
+			}
+		}
+		if f, ok := std[e.fn]; ok && allConst && len(args) == f.Arity {
+			return literal(f.Fn(vals...))
+		}
+		if e.fn == "pow" && len(args) == 2 {
+			if isLiteral(args[1], 0) {
+				return literal(1)
+			}
+			if isLiteral(args[1], 1) {
+				return args[0]
+			}
+		}
+		return call{e.fn, args, e.pos}
+	}
+	return e
+}
+
+// isLiteral reports whether e is the literal value v.
+func isLiteral(e Expr, v float64) bool {
+	l, ok := e.(literal)
+	return ok && float64(l) == v
+}
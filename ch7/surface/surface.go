@@ -4,6 +4,7 @@
 // See page 203.
 
 // The surface program plots the 3-D surface of a user-provided function.
+// See gopl.io/ch3/surface for a server with full rendering options.
 package main
 
 import (
@@ -64,16 +65,18 @@ func surface(w io.Writer, f func(x, y float64) float64) {
 // -- main code for gopl.io/ch7/surface --
 
 //!+parseAndCheck
-func parseAndCheck(s string) (eval.Expr, error) {
+// parseAndCheck accepts a program, which may be a single
+// expression, e.g., "r2 = x*x + y*y; sin(r2) / r2".
+func parseAndCheck(s string) (*eval.Program, error) {
 	if s == "" {
 		return nil, fmt.Errorf("empty expression")
 	}
-	expr, err := eval.Parse(s)
+	prog, err := eval.ParseProgram(s)
 	if err != nil {
 		return nil, err
 	}
 	vars := make(map[eval.Var]bool)
-	if err := expr.Check(vars); err != nil {
+	if err := prog.Check(vars); err != nil {
 		return nil, err
 	}
 	for v := range vars {
@@ -81,7 +84,7 @@ func parseAndCheck(s string) (eval.Expr, error) {
 			return nil, fmt.Errorf("undefined variable: %s", v)
 		}
 	}
-	return expr, nil
+	return prog, nil
 }
 
 //!-parseAndCheck
@@ -89,15 +92,22 @@ func parseAndCheck(s string) (eval.Expr, error) {
 //!+plot
 func plot(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
-	expr, err := parseAndCheck(r.Form.Get("expr"))
+	prog, err := parseAndCheck(r.Form.Get("expr"))
+	if err != nil {
+		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := prog.Compile([]eval.Var{"x", "y", "r"})
 	if err != nil {
 		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	w.Header().Set("Content-Type", "image/svg+xml")
+	args := make([]float64, 3) // x, y, r; reused since surface is sequential
 	surface(w, func(x, y float64) float64 {
 		r := math.Hypot(x, y) // distance from (0,0)
-		return expr.Eval(eval.Env{"x": x, "y": y, "r": r})
+		args[0], args[1], args[2] = x, y, r
+		return f(args)
 	})
 }
 